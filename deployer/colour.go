@@ -23,12 +23,27 @@ var (
 	White   = Colour("\033[1;37m%s\033[0m")
 )
 
+var colourEnabled = true
+
+// SetColourEnabled turns colouring on or off for all the colour helpers. When off, they only format their arguments.
+func SetColourEnabled(enabled bool) {
+	colourEnabled = enabled
+}
+
+func ColourEnabled() bool {
+	return colourEnabled
+}
+
 func Colour(colorString string) func(...interface{}) string {
 	sprint := func(args ...interface{}) string {
+		format := colorString
+		if !colourEnabled {
+			format = "%s"
+		}
 		if len(args) <= 1 {
-			return fmt.Sprintf(colorString, args...)
+			return fmt.Sprintf(format, args...)
 		}
-		return fmt.Sprintf(colorString, fmt.Sprintf(args[0].(string), args[1:]...))
+		return fmt.Sprintf(format, fmt.Sprintf(args[0].(string), args[1:]...))
 	}
 	return sprint
 }
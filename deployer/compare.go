@@ -0,0 +1,172 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-client-k8s/predict"
+	"math"
+)
+
+// Ways of comparing the outputs of two predictors
+const (
+	CompareTolerance = "tolerance" // Every output value differs by at most Tolerance
+	CompareArgmax    = "argmax"    // The index of the highest value of every row of the outputs is the same
+)
+
+// outputRows decodes a response with codec, and returns the values of its first output split into rows along the
+// first dimension
+func outputRows(codec predict.Codec, response json.RawMessage) ([][]float64, error) {
+	payload, err := codec.DecodeResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Format == predict.Binary || len(payload.Tensors) == 0 {
+		return nil, fmt.Errorf("response has no numeric outputs to compare")
+	}
+	return payload.Tensors[0].Rows()
+}
+
+func argmax(values []float64) int {
+	index := 0
+	for i, value := range values {
+		if value > values[index] {
+			index = i
+		}
+	}
+	return index
+}
+
+// PredictionComparison describes whether two predictors agreed on a single request payload
+type PredictionComparison struct {
+	Line   int    `json:"line"` // Line of the request payload in the requests file
+	Agree  bool   `json:"agree"`
+	Reason string `json:"reason,omitempty"` // Why the predictors did not agree
+}
+
+// ComparePredictions sends every request payload of a JSON Lines file to the deployed model and to a reference
+// predictor, e.g. the model that is being replaced, and fails if their outputs agree on fewer than MinAgreement of
+// the payloads. Outputs are compared with Tolerance, or by their argmax if Comparison is CompareArgmax. Both are
+// expected to speak the protocol the deployment declares.
+type ComparePredictions struct {
+	RequestsFile string  // JSON Lines file with a request payload on every line
+	BaseURL      string  // Base URL of the model's REST API, see Predict
+	IngressURL   string  // URL of the Seldon ingress, see Predict
+	ReferenceURL string  // Base URL of the REST API of the reference predictor
+	Comparison   string  // CompareTolerance if not given
+	Tolerance    float64 // Largest difference between two output values that are equal
+	MinAgreement float64 // Lowest fraction of payloads the predictors have to agree on, between 0 and 1
+
+	Comparisons []PredictionComparison `json:"-"` // Comparisons of the requests sent by the last Do
+}
+
+func (c *ComparePredictions) Eventless() {}
+
+func (c *ComparePredictions) Do(ctx context.Context, d *Deployer) error {
+	logger := d.logFor(c)
+	switch c.Comparison {
+	case "", CompareTolerance, CompareArgmax:
+	default:
+		return WithKind(ErrValidation, fmt.Errorf("unknown comparison '%s'", c.Comparison))
+	}
+	if c.ReferenceURL == "" {
+		return WithKind(ErrValidation, fmt.Errorf("comparing predictions needs the URL of a reference predictor"))
+	}
+	url, codec, err := predictionsURL(d, c.BaseURL, c.IngressURL)
+	if err != nil {
+		return err
+	}
+	referenceURL, _, err := predictionsURL(d, c.ReferenceURL, "")
+	if err != nil {
+		return err
+	}
+	payloads, err := readPayloadsFile(c.RequestsFile)
+	if err != nil {
+		return err
+	}
+	if d.dryRun {
+		logger.Infof("Not comparing predictions of %s and %s in a dry run", url, referenceURL)
+		return nil
+	}
+
+	logger.Info(ActionLog("Comparing predictions of %s and %s for %d requests...", url, referenceURL, len(payloads)))
+	c.Comparisons = make([]PredictionComparison, 0, len(payloads))
+	for _, payload := range payloads {
+		comparison := c.compare(codec,
+			sendPrediction(ctx, d.httpClient, url, payload),
+			sendPrediction(ctx, d.httpClient, referenceURL, payload),
+		)
+		if !comparison.Agree {
+			logger.WithField("line", comparison.Line).Warn(comparison.Reason)
+		}
+		c.Comparisons = append(c.Comparisons, comparison)
+	}
+	logger.WithField("agreement", c.agreement()).Infof("Compared %d predictions", len(c.Comparisons))
+	return nil
+}
+
+// compare compares the outputs of the model and the reference predictor for the same payload
+func (c *ComparePredictions) compare(codec predict.Codec, result, reference PredictionResult) PredictionComparison {
+	comparison := PredictionComparison{Line: result.Line}
+	disagree := func(format string, args ...interface{}) PredictionComparison {
+		comparison.Reason = fmt.Sprintf(format, args...)
+		return comparison
+	}
+	if result.Failed() {
+		return disagree("model failed: %s", result.Error)
+	}
+	if reference.Failed() {
+		return disagree("reference failed: %s", reference.Error)
+	}
+	rows, err := outputRows(codec, result.Response)
+	if err != nil {
+		return disagree("model: %s", err)
+	}
+	referenceRows, err := outputRows(codec, reference.Response)
+	if err != nil {
+		return disagree("reference: %s", err)
+	}
+	if len(rows) != len(referenceRows) {
+		return disagree("model returned %d rows, reference returned %d", len(rows), len(referenceRows))
+	}
+	for i := range rows {
+		if len(rows[i]) != len(referenceRows[i]) {
+			return disagree("row %d has %d values, reference has %d", i, len(rows[i]), len(referenceRows[i]))
+		}
+		if c.Comparison == CompareArgmax {
+			if got, want := argmax(rows[i]), argmax(referenceRows[i]); got != want {
+				return disagree("row %d has argmax %d, reference has %d", i, got, want)
+			}
+			continue
+		}
+		for j := range rows[i] {
+			if math.Abs(rows[i][j]-referenceRows[i][j]) > c.Tolerance {
+				return disagree("row %d has %g at %d, reference has %g", i, rows[i][j], j, referenceRows[i][j])
+			}
+		}
+	}
+	comparison.Agree = true
+	return comparison
+}
+
+// agreement returns the fraction of the compared payloads the predictors agreed on
+func (c *ComparePredictions) agreement() float64 {
+	if len(c.Comparisons) == 0 {
+		return 0
+	}
+	agreed := 0
+	for _, comparison := range c.Comparisons {
+		if comparison.Agree {
+			agreed++
+		}
+	}
+	return float64(agreed) / float64(len(c.Comparisons))
+}
+
+func (c *ComparePredictions) Done(event Event) (bool, error) {
+	if agreement := c.agreement(); agreement < c.MinAgreement {
+		return false, fmt.Errorf("predictions agreed on %.1f%% of the requests, which is less than the required %.1f%%",
+			agreement*100, c.MinAgreement*100)
+	}
+	return true, nil
+}
@@ -0,0 +1,103 @@
+package deployer
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-client-k8s/predict"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOutputRows(t *testing.T) {
+	codec, err := predict.CodecFor(predict.Seldon)
+	require.NoError(t, err)
+
+	rows, err := outputRows(codec, json.RawMessage(`{"data":{"names":["a","b"],"ndarray":[[0.1,0.9],[0.8,0.2]]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, [][]float64{{0.1, 0.9}, {0.8, 0.2}}, rows)
+
+	rows, err = outputRows(codec, json.RawMessage(`{"data":{"tensor":{"shape":[2,2],"values":[0.1,0.9,0.8,0.2]}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, [][]float64{{0.1, 0.9}, {0.8, 0.2}}, rows)
+
+	_, err = outputRows(codec, json.RawMessage(`{"data":{"ndarray":[["a"]]}}`))
+	assert.Error(t, err)
+	_, err = outputRows(codec, json.RawMessage(`{"binData":"aW1hZ2U="}`))
+	assert.Error(t, err)
+}
+
+// newFixedModelServer returns a stand-in for a model's REST API that always responds with response
+func newFixedModelServer(t *testing.T, response string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDeployer_RunInstructions_ComparePredictions(t *testing.T) {
+	reference := newFixedModelServer(t, `{"data":{"ndarray":[[0.10,0.90],[0.70,0.30]]}}`)
+	requestsFile := writeRequestsFile(t, `{"data":{"ndarray":[[1,2],[3,4]]}}`, `{"data":{"ndarray":[[5,6],[7,8]]}}`)
+
+	tests := []struct {
+		name       string
+		response   string
+		comparison string
+		agree      bool
+	}{
+		{"within tolerance", `{"data":{"ndarray":[[0.11,0.89],[0.69,0.31]]}}`, CompareTolerance, true},
+		{"outside tolerance", `{"data":{"ndarray":[[0.40,0.60],[0.70,0.30]]}}`, CompareTolerance, false},
+		{"same argmax", `{"data":{"tensor":{"shape":[2,2],"values":[0.40,0.60,0.55,0.45]}}}`, CompareArgmax, true},
+		{"different argmax", `{"data":{"ndarray":[[0.60,0.40],[0.70,0.30]]}}`, CompareArgmax, false},
+		{"different shape", `{"data":{"ndarray":[[0.10,0.90]]}}`, CompareArgmax, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := newFixedModelServer(t, tt.response)
+			deployer, _ := newTestDeployer(t, nil)
+			compare := &ComparePredictions{
+				RequestsFile: requestsFile,
+				BaseURL:      model.URL,
+				ReferenceURL: reference.URL,
+				Comparison:   tt.comparison,
+				Tolerance:    0.05,
+				MinAgreement: 1,
+			}
+
+			err := deployer.RunInstructions([]DeploymentInstruction{compare})
+			require.Len(t, compare.Comparisons, 2)
+			if tt.agree {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "predictions agreed on 0.0% of the requests")
+			assert.NotEmpty(t, compare.Comparisons[0].Reason)
+		})
+	}
+
+	t.Run("agreement at the threshold passes", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > 30 {
+				http.Error(w, `{}`, http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(`{"data":{"ndarray":[[0.10,0.90],[0.70,0.30]]}}`))
+		}))
+		defer failing.Close()
+		deployer, _ := newTestDeployer(t, nil)
+		compare := &ComparePredictions{
+			RequestsFile: writeRequestsFile(t, `{"data":{"ndarray":[[1]]}}`, `{"data":{"ndarray":[[1,2,3,4,5,6]]}}`),
+			BaseURL:      failing.URL,
+			ReferenceURL: reference.URL,
+			MinAgreement: 0.5,
+		}
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{compare}))
+		assert.Equal(t, []bool{true, false}, []bool{compare.Comparisons[0].Agree, compare.Comparisons[1].Agree})
+		assert.Contains(t, compare.Comparisons[1].Reason, "model failed")
+	})
+}
@@ -0,0 +1,322 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/jsonpath"
+	"strings"
+	"sync"
+)
+
+// compositeInstruction is implemented by instructions that are made up of other instructions, like Parallel. They
+// wait for their instructions to be done in Do already, so there are no events left to wait for once they have been
+// carried out.
+type compositeInstruction interface {
+	children() []DeploymentInstruction
+}
+
+// waitsForEvents returns whether the events of the deployment have to be waited for once instruction has been carried
+// out, which is the case unless it is an EventlessInstruction or a composite instruction
+func waitsForEvents(instruction DeploymentInstruction) bool {
+	if _, eventless := instruction.(EventlessInstruction); eventless {
+		return false
+	}
+	_, composite := instruction.(compositeInstruction)
+	return !composite
+}
+
+// Parallel carries out independent instructions at the same time, e.g. load tests of two predictors. Do carries out
+// every instruction in a go routine of its own, and waits for it to be done like for the instructions of a run. Every
+// instruction waits for the events on a queue of its own, which all events are passed on to. Parallel is done once all
+// of its instructions are. The instructions share the Deployer, so at most one of them should change what later
+// instructions rely on, e.g. open a port-forward.
+//
+// With FailFast, the first error of an instruction fails Parallel straight away, and cancels the context of the
+// others. Otherwise, Parallel waits for all instructions to be done or to have failed, and returns the errors of all
+// failed ones.
+type Parallel struct {
+	Instructions Instructions
+	FailFast     bool
+
+	errs []error // What each failed instruction failed with
+}
+
+func (p *Parallel) children() []DeploymentInstruction {
+	return p.Instructions
+}
+
+func (p *Parallel) Do(ctx context.Context, d *Deployer) error {
+	d.logFor(p).Info(ActionLog("Carrying out %d instructions in parallel...", len(p.Instructions)))
+	p.errs = make([]error, len(p.Instructions))
+	ctx, cancelFunc := context.WithCancel(ctx)
+	defer cancelFunc()
+
+	// The queues are branched off before any instruction is carried out, so that none of them misses an event
+	events := d.eventsFor(ctx)
+	branches := make([]*eventQueue, len(p.Instructions))
+	for i := range branches {
+		branches[i] = events.branch()
+		defer events.removeBranch(branches[i])
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var firstErr error
+	for i, instruction := range p.Instructions {
+		wg.Add(1)
+		go func(i int, instruction DeploymentInstruction) {
+			defer wg.Done()
+			report := newInstructionReport(instruction)
+			err := d.executeInstruction(withEvents(ctx, branches[i]), instruction, &report)
+			if err == nil {
+				return
+			}
+			err = errors.Wrapf(err, "%s failed", instructionName(instruction))
+			mutex.Lock()
+			defer mutex.Unlock()
+			p.errs[i] = err
+			if firstErr == nil {
+				firstErr = err
+			}
+			if p.FailFast {
+				cancelFunc()
+			}
+		}(i, instruction)
+	}
+	wg.Wait()
+	if p.FailFast || firstErr == nil {
+		return firstErr
+	}
+	return p.err()
+}
+
+// Done has nothing left to wait for, as Do has waited for all instructions to be done
+func (p *Parallel) Done(event Event) (bool, error) {
+	return true, nil
+}
+
+// err combines the errors of the failed instructions. The first of them is kept as the cause, so that its error kind
+// is kept as well.
+func (p *Parallel) err() error {
+	var cause error
+	var messages []string
+	for _, err := range p.errs {
+		if err == nil {
+			continue
+		}
+		if cause == nil {
+			cause = err
+		}
+		messages = append(messages, err.Error())
+	}
+	return &parallelError{
+		message: fmt.Sprintf("%d of %d parallel instructions failed: %s", len(messages), len(p.errs),
+			strings.Join(messages, "; ")),
+		cause: cause,
+	}
+}
+
+type parallelError struct {
+	message string
+	cause   error
+}
+
+func (e *parallelError) Error() string {
+	return e.message
+}
+
+func (e *parallelError) Unwrap() error {
+	return e.cause
+}
+
+// Cause lets errors.Cause find the Kubernetes API error an instruction may have failed with
+func (e *parallelError) Cause() error {
+	return e.cause
+}
+
+// runNested carries out the instructions of a composite instruction one after the other, and waits for each of them
+// to be done like for the instructions of a run. They are part of the trace of the run, but not of its Report.
+func (d *Deployer) runNested(ctx context.Context, instructions []DeploymentInstruction) error {
+	for _, instruction := range instructions {
+		report := newInstructionReport(instruction)
+		if err := d.executeInstruction(ctx, instruction, &report); err != nil {
+			return errors.Wrapf(err, "%s failed", instructionName(instruction))
+		}
+	}
+	return nil
+}
+
+// Sequence carries out its instructions one after the other, each of them waited for before the next one. It groups
+// instructions, e.g. in a branch of Parallel.
+type Sequence struct {
+	Instructions Instructions
+}
+
+func (s *Sequence) children() []DeploymentInstruction {
+	return s.Instructions
+}
+
+func (s *Sequence) Do(ctx context.Context, d *Deployer) error {
+	return d.runNested(ctx, s.Instructions)
+}
+
+// Done has nothing left to wait for, as Do has waited for all instructions to be done
+func (s *Sequence) Done(event Event) (bool, error) {
+	return true, nil
+}
+
+// Condition is checked against the SeldonDeployment as it currently is in the cluster, rather than as cached. All of
+// the checks that are given have to hold, and a condition without any checks always holds.
+type Condition struct {
+	Exists *bool                         `json:",omitempty"` // Whether the deployment exists
+	State  machinelearningv1.StatusState `json:",omitempty"` // The state of the deployment
+	Field  string                        `json:",omitempty"` // JSONPath of a field, e.g. spec.predictors[0].replicas
+	Equals string                        `json:",omitempty"` // The value of Field, as kubectl would print it
+}
+
+func (c *Condition) holds(ctx context.Context, d *Deployer) (bool, error) {
+	deploy, err := d.client.Get(ctx, d.name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		deploy, err = nil, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "could not get deployment %s to check the condition", d.name)
+	}
+	return c.check(deploy)
+}
+
+// check returns whether the condition holds for deploy, which is nil if the deployment does not exist
+func (c *Condition) check(deploy *machinelearningv1.SeldonDeployment) (bool, error) {
+	if c.Exists != nil && *c.Exists != (deploy != nil) {
+		return false, nil
+	}
+	if deploy == nil {
+		return c.State == "" && c.Field == "", nil
+	}
+	if c.State != "" && deploy.Status.State != c.State {
+		return false, nil
+	}
+	if c.Field == "" {
+		return true, nil
+	}
+	value, err := fieldValue(deploy, c.Field)
+	if err != nil {
+		return false, err
+	}
+	return value == c.Equals, nil
+}
+
+// fieldValue returns the value of the field at path, e.g. spec.replicas or {.spec.replicas}, or an empty string if the
+// deployment does not have it
+func fieldValue(deploy *machinelearningv1.SeldonDeployment, path string) (string, error) {
+	template := path
+	if !strings.HasPrefix(template, "{") {
+		template = "{." + strings.TrimPrefix(template, ".") + "}"
+	}
+	parser := jsonpath.New("field").AllowMissingKeys(true)
+	if err := parser.Parse(template); err != nil {
+		return "", WithKind(ErrValidation, errors.Wrapf(err, "invalid field path '%s'", path))
+	}
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deploy)
+	if err != nil {
+		return "", errors.Wrap(err, "could not convert deployment")
+	}
+	var value bytes.Buffer
+	if err := parser.Execute(&value, object); err != nil {
+		return "", WithKind(ErrValidation, errors.Wrapf(err, "could not get field '%s'", path))
+	}
+	return value.String(), nil
+}
+
+// If carries out the instructions of Then if Condition holds when it is carried out, and those of Else otherwise, one
+// after the other like a Sequence
+type If struct {
+	Condition Condition
+	Then      Instructions
+	Else      Instructions
+}
+
+func (i *If) children() []DeploymentInstruction {
+	return append(append(Instructions{}, i.Then...), i.Else...)
+}
+
+func (i *If) Do(ctx context.Context, d *Deployer) error {
+	holds, err := i.Condition.holds(ctx, d)
+	if err != nil {
+		return err
+	}
+	if holds {
+		d.logFor(i).Info(DescriptionLog("Condition holds. Carrying out %d instructions", len(i.Then)))
+		return d.runNested(ctx, i.Then)
+	}
+	d.logFor(i).Info(DescriptionLog("Condition does not hold. Carrying out %d other instructions", len(i.Else)))
+	return d.runNested(ctx, i.Else)
+}
+
+// Done has nothing left to wait for, as Do has waited for the instructions it carried out to be done
+func (i *If) Done(event Event) (bool, error) {
+	return true, nil
+}
+
+// Repeat carries out its instructions one after the other, over and over. It stops after Times repetitions, or once
+// Until holds, which is checked before every repetition. If both are given, Until has to hold within Times
+// repetitions. In a dry run nothing changes, so the instructions are only carried out once.
+type Repeat struct {
+	Times        int        `json:",omitempty"`
+	Until        *Condition `json:",omitempty"`
+	Instructions Instructions
+}
+
+func (r *Repeat) children() []DeploymentInstruction {
+	return r.Instructions
+}
+
+func (r *Repeat) Do(ctx context.Context, d *Deployer) error {
+	if r.Times < 0 || (r.Times == 0 && r.Until == nil) {
+		return WithKind(ErrValidation, fmt.Errorf("repeat needs a positive number of times or a condition to stop at"))
+	}
+	logger := d.logFor(r)
+	for repetition := 0; r.Times == 0 || repetition < r.Times; repetition++ {
+		if ctx.Err() != nil {
+			return errors.Wrapf(ctx.Err(), "stopped after %d repetitions", repetition)
+		}
+		if r.Until != nil {
+			holds, err := r.Until.holds(ctx, d)
+			if err != nil {
+				return err
+			}
+			if holds {
+				logger.Info(DescriptionLog("Condition holds after %d repetitions", repetition))
+				return nil
+			}
+		}
+		if err := d.runNested(ctx, r.Instructions); err != nil {
+			return errors.Wrapf(err, "repetition %d failed", repetition+1)
+		}
+		if d.dryRun {
+			return nil
+		}
+	}
+	if r.Until == nil {
+		return nil
+	}
+	holds, err := r.Until.holds(ctx, d)
+	if err != nil {
+		return err
+	}
+	if !holds {
+		return fmt.Errorf("condition does not hold after %d repetitions", r.Times)
+	}
+	return nil
+}
+
+// Done has nothing left to wait for, as Do has waited for every repetition to be done
+func (r *Repeat) Done(event Event) (bool, error) {
+	return true, nil
+}
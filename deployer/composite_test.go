@@ -0,0 +1,251 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+// stateInstruction changes nothing itself, and is done once the deployment is in State
+type stateInstruction struct {
+	State  machinelearningv1.StatusState
+	events int
+}
+
+func (s *stateInstruction) Do(ctx context.Context, d *Deployer) error {
+	return nil
+}
+
+func (s *stateInstruction) Done(event Event) (bool, error) {
+	s.events++
+	return event.Deployment.Status.State == s.State, nil
+}
+
+// eventlessInstruction is done once it has been carried out, unless it is given an error to fail with
+type eventlessInstruction struct {
+	doErr   error
+	doneErr error
+	block   bool // Block in Do until the context is cancelled
+}
+
+func (e *eventlessInstruction) Eventless() {}
+
+func (e *eventlessInstruction) Do(ctx context.Context, d *Deployer) error {
+	if e.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return e.doErr
+}
+
+func (e *eventlessInstruction) Done(event Event) (bool, error) {
+	return e.doneErr == nil, e.doneErr
+}
+
+func TestWaitsForEvents(t *testing.T) {
+	assert.False(t, waitsForEvents(&eventlessInstruction{}))
+	assert.True(t, waitsForEvents(&Create{}))
+	for _, composite := range []DeploymentInstruction{
+		&Parallel{Instructions: Instructions{&eventlessInstruction{}, &Delete{}}},
+		&Sequence{Instructions: Instructions{&Delete{}}},
+		&If{Then: Instructions{&Delete{}}},
+		&Repeat{Times: 1, Instructions: Instructions{&Delete{}}},
+	} {
+		assert.False(t, waitsForEvents(composite), "the instructions of a %s have been waited for already",
+			instructionName(composite))
+	}
+}
+
+func TestParallel(t *testing.T) {
+	t.Run("events fan out to every instruction", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, nil)
+		creating := &stateInstruction{State: machinelearningv1.StatusStateCreating}
+		available := &stateInstruction{State: machinelearningv1.StatusStateAvailable}
+		parallel := &Parallel{Instructions: []DeploymentInstruction{&Create{}, creating, available, &eventlessInstruction{}}}
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{parallel}))
+		assert.Greater(t, available.events, creating.events, "the instructions that are done are not checked anymore")
+	})
+
+	t.Run("only eventless instructions do not wait for events", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, nil, WithTimeout(time.Second))
+		parallel := &Parallel{Instructions: []DeploymentInstruction{&eventlessInstruction{}, &eventlessInstruction{}}}
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{parallel}))
+	})
+
+	t.Run("fail fast cancels the other instructions", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, nil)
+		parallel := &Parallel{
+			Instructions: []DeploymentInstruction{&eventlessInstruction{block: true}, &eventlessInstruction{doErr: fmt.Errorf("boom")}},
+			FailFast:     true,
+		}
+		err := deployer.RunInstructions([]DeploymentInstruction{parallel})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "boom")
+	})
+
+	t.Run("without fail fast all instructions finish and all errors are returned", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, nil)
+		parallel := &Parallel{Instructions: []DeploymentInstruction{
+			&Create{},
+			&eventlessInstruction{doneErr: WithKind(ErrValidation, fmt.Errorf("wrong responses"))},
+			&eventlessInstruction{doErr: fmt.Errorf("no pod")},
+		}}
+		err := deployer.RunInstructions([]DeploymentInstruction{parallel})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "2 of 3 parallel instructions failed")
+		assert.Contains(t, err.Error(), "wrong responses")
+		assert.Contains(t, err.Error(), "no pod")
+		assert.True(t, errors.Is(err, ErrValidation), "the first error is kept as the cause")
+		assert.True(t, errors.Is(err, ErrRolledBack), "the create was waited for")
+	})
+}
+
+func TestCondition_check(t *testing.T) {
+	exists, missing := true, false
+	deploy := newTestDeployment()
+	deploy.Spec.Replicas = int32Ptr(3)
+	deploy.Spec.Predictors = []machinelearningv1.PredictorSpec{{Name: "default", Replicas: int32Ptr(2)}}
+	deploy.Status.State = machinelearningv1.StatusStateAvailable
+
+	for name, test := range map[string]struct {
+		condition Condition
+		deploy    *machinelearningv1.SeldonDeployment
+		holds     bool
+	}{
+		"no checks":                {Condition{}, deploy, true},
+		"exists":                   {Condition{Exists: &exists}, deploy, true},
+		"does not exist":           {Condition{Exists: &missing}, nil, true},
+		"exists but is missing":    {Condition{Exists: &exists}, nil, false},
+		"state of a missing one":   {Condition{State: machinelearningv1.StatusStateAvailable}, nil, false},
+		"state":                    {Condition{State: machinelearningv1.StatusStateAvailable}, deploy, true},
+		"other state":              {Condition{State: machinelearningv1.StatusStateFailed}, deploy, false},
+		"field":                    {Condition{Field: "spec.replicas", Equals: "3"}, deploy, true},
+		"field as JSONPath":        {Condition{Field: "{.spec.predictors[0].replicas}", Equals: "2"}, deploy, true},
+		"field with another value": {Condition{Field: ".spec.replicas", Equals: "2"}, deploy, false},
+		"missing field":            {Condition{Field: "spec.predictors[0].graph.name"}, deploy, true},
+		"all checks":               {Condition{Exists: &exists, State: machinelearningv1.StatusStateAvailable, Field: "spec.replicas", Equals: "4"}, deploy, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			holds, err := test.condition.check(test.deploy)
+			require.NoError(t, err)
+			assert.Equal(t, test.holds, holds)
+		})
+	}
+
+	_, err := (&Condition{Field: "{.spec["}).check(deploy)
+	assert.True(t, errors.Is(err, ErrValidation))
+}
+
+func TestIf(t *testing.T) {
+	exists := true
+	createOrUpdate := func() DeploymentInstruction {
+		return &If{Condition: Condition{Exists: &exists}, Then: Instructions{&Update{}}, Else: Instructions{&Create{}}}
+	}
+	provider, exporter := newTestTracerProvider()
+	deployer, _ := newTestDeployer(t, nil, WithTracerProvider(provider))
+
+	require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{createOrUpdate(), createOrUpdate()}))
+	spans := spansByName(exporter)
+	require.Len(t, spans["If"], 2)
+	require.Len(t, spans["Create"], 1, "the deployment did not exist yet")
+	require.Len(t, spans["Update"], 1, "the deployment existed")
+	assert.Equal(t, spans["If"][0].SpanContext.SpanID, spans["Create"][0].ParentSpanID)
+	assert.Equal(t, spans["If"][1].SpanContext.SpanID, spans["Update"][0].ParentSpanID)
+}
+
+func TestRepeat(t *testing.T) {
+	t.Run("until a condition holds", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, nil)
+		repeat := &Repeat{
+			Until:        &Condition{Field: "spec.replicas", Equals: "3"},
+			Instructions: Instructions{&ScaleReplicas{By: 1}},
+		}
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}, repeat}))
+
+		deploy, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Get(context.Background(),
+			"seldon-deployment-example", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), *deploy.Spec.Replicas)
+		assert.Equal(t, int32(3), deploy.Status.Replicas, "every step was waited for")
+	})
+
+	t.Run("a number of times", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, nil)
+		count := &countingInstruction{}
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Repeat{Times: 3, Instructions: Instructions{count}}}))
+		assert.Equal(t, 3, count.done)
+	})
+
+	t.Run("a condition that does not hold in time", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, nil)
+		repeat := &Repeat{
+			Times:        2,
+			Until:        &Condition{State: machinelearningv1.StatusStateAvailable},
+			Instructions: Instructions{&countingInstruction{}},
+		}
+		err := deployer.RunInstructions([]DeploymentInstruction{repeat})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "condition does not hold after 2 repetitions")
+	})
+
+	t.Run("needs times or a condition", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, nil)
+		err := deployer.RunInstructions([]DeploymentInstruction{&Repeat{Instructions: Instructions{&countingInstruction{}}}})
+		assert.True(t, errors.Is(err, ErrValidation))
+	})
+}
+
+func TestSequence(t *testing.T) {
+	t.Run("in a parallel", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, nil)
+		sequence := &Sequence{Instructions: Instructions{&Create{}, &ScaleReplicas{NumReplicas: 2}}}
+		parallel := &Parallel{Instructions: Instructions{sequence, &eventlessInstruction{}}}
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{parallel}))
+
+		deploy, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Get(context.Background(),
+			"seldon-deployment-example", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), deploy.Status.Replicas)
+	})
+
+	t.Run("two waiting for events in a parallel", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, nil)
+		creating := &stateInstruction{State: machinelearningv1.StatusStateCreating}
+		available := &stateInstruction{State: machinelearningv1.StatusStateAvailable}
+		parallel := &Parallel{Instructions: Instructions{
+			&Sequence{Instructions: Instructions{&Create{}, &ScaleReplicas{NumReplicas: 2}}},
+			&Sequence{Instructions: Instructions{creating, available}},
+		}}
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{parallel}))
+
+		deploy, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Get(context.Background(),
+			"seldon-deployment-example", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), deploy.Status.Replicas)
+		assert.NotZero(t, creating.events, "the events the first sequence waits for are seen by the second one as well")
+		assert.NotZero(t, available.events)
+	})
+}
+
+// countingInstruction counts how often it has been carried out
+type countingInstruction struct {
+	done int
+}
+
+func (c *countingInstruction) Eventless() {}
+
+func (c *countingInstruction) Do(ctx context.Context, d *Deployer) error {
+	c.done++
+	return nil
+}
+
+func (c *countingInstruction) Done(event Event) (bool, error) {
+	return true, nil
+}
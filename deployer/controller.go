@@ -0,0 +1,311 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	seldonclientset "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// The label the Controller puts on the SeldonDeployments it manages. Only SeldonDeployments with this label are ever
+// deleted by the Controller.
+const (
+	ManagedByLabel      = "app.kubernetes.io/managed-by"
+	ManagedByController = "go-client-k8s"
+)
+
+// Controller continuously reconciles the SeldonDeployments in the cluster toward the desired SeldonDeployments of a
+// DesiredSource: missing ones are created, ones that drifted from their manifest are updated again and managed ones
+// that are no longer desired are deleted. Changes are picked up from the events of an Observer's informer, and the
+// desired set is read again every resync period.
+type Controller struct {
+	client    seldonclientset.Interface
+	observer  *ObserverV2
+	source    DesiredSource
+	queue     workqueue.RateLimitingInterface // Keys of the SeldonDeployments to reconcile, as namespace/name
+	resync    time.Duration
+	namespace string // Overrides the namespace of the manifests if set
+	workers   int
+	dryRun    bool
+	log       log.FieldLogger
+
+	mutex   sync.RWMutex
+	desired map[string]*machinelearningv1.SeldonDeployment // Desired SeldonDeployments by key, nil until first read
+}
+
+// NewController creates a Controller for the SeldonDeployments of clientset. WithResync sets how often the desired
+// set is read, WithNamespace puts every desired SeldonDeployment in the same namespace, WithWorkers sets how many
+// SeldonDeployments are reconciled at the same time and WithDryRun only sends server-side dry runs.
+func NewController(clientset seldonclientset.Interface, source DesiredSource, opts ...Option) *Controller {
+	options := newOptions(opts)
+	controller := &Controller{
+		client:    clientset,
+		observer:  newObserver(clientset, nil, options),
+		source:    source,
+		queue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "seldondeployments"),
+		resync:    options.resync,
+		namespace: options.namespace,
+		workers:   options.workers,
+		dryRun:    options.dryRun,
+		log:       options.deployerLogger().WithField(ComponentField, "controller"),
+	}
+	controller.observer.SetNotifyFunc(controller.enqueueEvent)
+	return controller
+}
+
+// Run reconciles until ctx is cancelled. It returns once the workers have stopped, or with an error if ctx is
+// cancelled before the informer cache has synced.
+func (c *Controller) Run(ctx context.Context) error {
+	defer c.queue.ShutDown()
+	go c.observer.WaitTillContextIsCancelled(ctx)
+	go c.observer.Run()
+
+	c.log.Info(EventLog("Waiting for the informer cache to sync..."))
+	if !cache.WaitForCacheSync(ctx.Done(), c.observer.hasSynced) {
+		return WithKind(ErrTimeout, fmt.Errorf("informer cache did not sync before the controller was stopped"))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		wait.UntilWithContext(ctx, c.reload, c.resync)
+	}()
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c.processNextItem(ctx) {
+			}
+		}()
+	}
+	c.log.WithField("workers", c.workers).Info(MileStoneLog("Reconciling deployments of %s", c.source))
+
+	<-ctx.Done()
+	c.queue.ShutDown()
+	wg.Wait()
+	c.log.Info(EventLog("Controller has stopped"))
+	return nil
+}
+
+func (c *Controller) enqueueEvent(event Event) error {
+	if event.Deployment == nil {
+		return fmt.Errorf("received an event with nil Deployment")
+	}
+	c.queue.Add(event.Deployment.Namespace + "/" + event.Deployment.Name)
+	return nil
+}
+
+// reload reads the desired SeldonDeployments, and queues them together with every managed SeldonDeployment. If the
+// source cannot be read, the previous desired set is kept, so that nothing is deleted because of a broken manifest.
+func (c *Controller) reload(ctx context.Context) {
+	deployments, err := c.source.Desired(ctx)
+	if err != nil {
+		c.log.WithError(err).Error(ThisNeedsAttentionLog("could not read desired deployments. Keeping the previous ones"))
+		return
+	}
+	desired, err := c.desiredByKey(deployments)
+	if err != nil {
+		c.log.WithError(err).Error(ThisNeedsAttentionLog("invalid desired deployments. Keeping the previous ones"))
+		return
+	}
+	c.mutex.Lock()
+	c.desired = desired
+	c.mutex.Unlock()
+
+	for key := range desired {
+		c.queue.Add(key)
+	}
+	managed, err := c.observer.lister().List(labels.SelectorFromSet(labels.Set{ManagedByLabel: ManagedByController}))
+	if err != nil {
+		c.log.WithError(err).Error("could not list managed deployments")
+		return
+	}
+	for _, deployment := range managed {
+		c.queue.Add(deployment.Namespace + "/" + deployment.Name)
+	}
+}
+
+// desiredByKey resolves the namespace of every desired SeldonDeployment, and keys them by namespace and name. It fails
+// on SeldonDeployments that only turn out to be the same once their namespace is resolved.
+func (c *Controller) desiredByKey(deployments []*machinelearningv1.SeldonDeployment) (map[string]*machinelearningv1.SeldonDeployment, error) {
+	desired := make(map[string]*machinelearningv1.SeldonDeployment, len(deployments))
+	for _, deployment := range deployments {
+		switch {
+		case c.namespace != "":
+			deployment.SetNamespace(c.namespace)
+		case deployment.GetNamespace() == "":
+			deployment.SetNamespace(v1.NamespaceDefault)
+		}
+		key := deployment.Namespace + "/" + deployment.Name
+		if _, ok := desired[key]; ok {
+			return nil, fmt.Errorf("%s is desired more than once", key)
+		}
+		desired[key] = deployment
+	}
+	return desired, nil
+}
+
+// processNextItem reconciles the next queued key, and returns false once the queue has been shut down. Keys that
+// fail to reconcile are queued again with an exponential backoff.
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	item, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(item)
+
+	key := item.(string)
+	if err := c.reconcile(ctx, key); err != nil {
+		c.log.WithError(err).WithField("key", key).Warn("could not reconcile deployment. Retrying...")
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// reconcile brings a single SeldonDeployment in line with the desired set, as seen by the informer cache
+func (c *Controller) reconcile(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	c.mutex.RLock()
+	loaded, desired := c.desired != nil, c.desired[key]
+	c.mutex.RUnlock()
+	if !loaded {
+		// Everything is queued again once the desired set has been read
+		return nil
+	}
+
+	logger := c.log.WithFields(deploymentFields(namespace, name))
+	client := c.client.MachinelearningV1().SeldonDeployments(namespace)
+	existing, err := c.observer.lister().SeldonDeployments(namespace).Get(name)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrapf(err, "could not get deployment %s from the cache", key)
+	}
+	exists := err == nil
+
+	switch {
+	case desired == nil:
+		if !exists || !isManaged(existing) || existing.DeletionTimestamp != nil {
+			return nil
+		}
+		logger.Info(ActionLog("Deleting deployment that is no longer desired..."))
+		delPolicy := metav1.DeletePropagationBackground
+		err := client.Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &delPolicy, DryRun: c.dryRunOption()})
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "could not delete deployment %s", key)
+	case !exists:
+		logger.Info(ActionLog("Creating desired deployment..."))
+		_, err := client.Create(ctx, managedCopy(desired), metav1.CreateOptions{DryRun: c.dryRunOption()})
+		return errors.Wrapf(err, "could not create deployment %s", key)
+	case existing.DeletionTimestamp != nil:
+		// It is created again once it is gone, as its removal is an event as well
+		logger.Debug("Desired deployment is being deleted. Waiting for it to be gone")
+		return nil
+	case !isManaged(existing) || specDrifted(desired.Spec, existing.Spec):
+		logger.Info(ActionLog("Deployment drifted from its manifest. Applying it again..."))
+		update := managedCopy(existing)
+		update.Spec = *desired.Spec.DeepCopy()
+		_, err := client.Update(ctx, update, metav1.UpdateOptions{DryRun: c.dryRunOption()})
+		// Conflicts are retried with the queue's backoff, once the cache has caught up
+		return errors.Wrapf(err, "could not update deployment %s", key)
+	}
+	return nil
+}
+
+func (c *Controller) dryRunOption() []string {
+	if c.dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+func isManaged(deployment *machinelearningv1.SeldonDeployment) bool {
+	return deployment.GetLabels()[ManagedByLabel] == ManagedByController
+}
+
+// managedCopy returns a copy of deployment with the label of the SeldonDeployments the Controller manages
+func managedCopy(deployment *machinelearningv1.SeldonDeployment) *machinelearningv1.SeldonDeployment {
+	deployment = deployment.DeepCopy()
+	if deployment.Labels == nil {
+		deployment.Labels = map[string]string{}
+	}
+	deployment.Labels[ManagedByLabel] = ManagedByController
+	return deployment
+}
+
+// specDrifted returns whether actual differs from desired in any field that desired sets. Fields that are only set
+// in actual, e.g. defaults filled in by the Seldon operator, are not drift.
+func specDrifted(desired, actual machinelearningv1.SeldonDeploymentSpec) bool {
+	var desiredFields, actualFields interface{}
+	if err := roundTripJSON(desired, &desiredFields); err != nil {
+		return true
+	}
+	if err := roundTripJSON(actual, &actualFields); err != nil {
+		return true
+	}
+	return !containsFields(desiredFields, actualFields)
+}
+
+func roundTripJSON(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// containsFields returns whether every field of desired is set to the same value in actual. Lists have to be of the
+// same length, and their elements are compared in the same way. Null and empty string fields of desired are unset.
+func containsFields(desired, actual interface{}) bool {
+	switch desired := desired.(type) {
+	case map[string]interface{}:
+		actual, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for field, value := range desired {
+			if !containsFields(value, actual[field]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		actual, ok := actual.([]interface{})
+		if !ok || len(actual) != len(desired) {
+			return false
+		}
+		for i := range desired {
+			if !containsFields(desired[i], actual[i]) {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return true
+	case string:
+		// Fields without omitempty are written even if the manifest leaves them out
+		if desired == "" {
+			return true
+		}
+	}
+	return reflect.DeepEqual(desired, actual)
+}
@@ -0,0 +1,124 @@
+package deployer
+
+import (
+	"context"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-client-k8s/deployertest"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpecDrifted(t *testing.T) {
+	desired := machinelearningv1.SeldonDeploymentSpec{
+		Replicas:   int32Ptr(1),
+		Predictors: []machinelearningv1.PredictorSpec{{Name: "default"}},
+	}
+
+	defaulted := *desired.DeepCopy()
+	defaulted.Protocol = machinelearningv1.ProtocolSeldon
+	defaulted.Predictors[0].Graph.Name = "classifier"
+	assert.False(t, specDrifted(desired, defaulted), "fields only set in the cluster are not drift")
+
+	scaled := *desired.DeepCopy()
+	scaled.Replicas = int32Ptr(3)
+	assert.True(t, specDrifted(desired, scaled))
+
+	extraPredictor := *desired.DeepCopy()
+	extraPredictor.Predictors = append(extraPredictor.Predictors, machinelearningv1.PredictorSpec{Name: "canary"})
+	assert.True(t, specDrifted(desired, extraPredictor))
+}
+
+func TestController_desiredByKey(t *testing.T) {
+	deployment := func(namespace string) *machinelearningv1.SeldonDeployment {
+		return &machinelearningv1.SeldonDeployment{ObjectMeta: metav1.ObjectMeta{Name: "model-a", Namespace: namespace}}
+	}
+
+	desired, err := (&Controller{}).desiredByKey([]*machinelearningv1.SeldonDeployment{deployment(""), deployment("seldon")})
+	require.NoError(t, err)
+	assert.Contains(t, desired, "default/model-a")
+	assert.Contains(t, desired, "seldon/model-a")
+
+	_, err = (&Controller{}).desiredByKey([]*machinelearningv1.SeldonDeployment{deployment(""), deployment("default")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "default/model-a is desired more than once")
+
+	_, err = (&Controller{namespace: "seldon"}).desiredByKey([]*machinelearningv1.SeldonDeployment{deployment("a"), deployment("b")})
+	assert.Error(t, err, "both are deployed into the namespace of the controller")
+}
+
+func TestController_Run(t *testing.T) {
+	unmanaged := &machinelearningv1.SeldonDeployment{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged", Namespace: "seldon"}}
+	stale := managedCopy(&machinelearningv1.SeldonDeployment{ObjectMeta: metav1.ObjectMeta{Name: "stale", Namespace: "seldon"}})
+	clientset := deployertest.NewClientset(unmanaged, stale)
+	deployments := clientset.MachinelearningV1().SeldonDeployments("seldon")
+	dir := t.TempDir()
+	writeManifest(t, dir, "model-a.yaml", modelAManifest)
+	writeManifest(t, dir, "model-b.json", modelBManifest)
+
+	logger, _ := test.NewNullLogger()
+	controller := NewController(clientset, DirectorySource(dir), WithNamespace("seldon"), WithResync(50*time.Millisecond),
+		WithWorkers(2), WithLogger(logger), WithObserverLogger(logger))
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- controller.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-stopped)
+	}()
+
+	exists := func(name string) bool {
+		_, err := deployments.Get(context.Background(), name, metav1.GetOptions{})
+		return !k8serrors.IsNotFound(err)
+	}
+	replicas := func(name string) int32 {
+		deployment, err := deployments.Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil || deployment.Spec.Replicas == nil {
+			return 0
+		}
+		return *deployment.Spec.Replicas
+	}
+
+	t.Run("creates desired and deletes stale deployments", func(t *testing.T) {
+		require.Eventually(t, func() bool { return exists("model-a") && exists("model-b") && !exists("stale") },
+			5*time.Second, 10*time.Millisecond)
+		assert.True(t, exists("unmanaged"), "deployments without the managed-by label should be left alone")
+
+		modelB, err := deployments.Get(context.Background(), "model-b", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, ManagedByController, modelB.Labels[ManagedByLabel])
+		assert.Equal(t, int32(2), *modelB.Spec.Replicas)
+	})
+
+	t.Run("applies manifests again on drift", func(t *testing.T) {
+		modelA, err := deployments.Get(context.Background(), "model-a", metav1.GetOptions{})
+		require.NoError(t, err)
+		modelA.Spec.Replicas = int32Ptr(5)
+		_, err = deployments.Update(context.Background(), modelA, metav1.UpdateOptions{})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool { return replicas("model-a") == 1 }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("deletes deployments removed from the desired set", func(t *testing.T) {
+		require.NoError(t, os.Remove(filepath.Join(dir, "model-b.json")))
+
+		require.Eventually(t, func() bool { return !exists("model-b") }, 5*time.Second, 10*time.Millisecond)
+		assert.True(t, exists("model-a"))
+	})
+
+	t.Run("keeps the previous desired set if the source cannot be read", func(t *testing.T) {
+		writeManifest(t, dir, "broken.yaml", "metadata: [")
+		time.Sleep(200 * time.Millisecond)
+
+		assert.True(t, exists("model-a"))
+	})
+}
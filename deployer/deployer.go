@@ -8,124 +8,581 @@ import (
 	seldonclientset "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned"
 	seldondeployment "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned/typed/machinelearning.seldon.io/v1"
 	log "github.com/sirupsen/logrus"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	"google.golang.org/grpc"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"net/http"
+	"sync"
 	"time"
 )
 
-// TODO: Keep Deployer instance alive until events are finished
+// Deployer carries out instructions on a single deployment. Start starts its Observer, after which any number of
+// RunInstructions calls can be made one after the other, and Close stops the Observer again. A RunInstructions call on a
+// Deployer that has not been started starts it for the length of the call.
 type Deployer struct {
 	name       string
-	eventChan  chan Event
+	namespace  string
+	events     *eventQueue // Events of the deployment observed since the current RunInstructions call started
 	replyChan  chan error
-	observer   *ObserverV2
+	observer   Observer
 	deployment *machinelearningv1.SeldonDeployment        // Schema/State of deployment
 	client     seldondeployment.SeldonDeploymentInterface // Equivalent to kubernetes.DeploymentInterface
+	created    bool                                       // Whether this run created the deployment and so owns its clean up
+	snapshot   *machinelearningv1.SeldonDeployment        // Deployment as cached before the last run, nil if it did not exist
+	report     *Report                                    // Report of the last RunInstructions call
+	log        log.FieldLogger
+	timeout    time.Duration
+	dryRun     bool
+	recorder   record.EventRecorder
+	httpClient *http.Client // Client for requests to the served model
+	kubeClient kubernetes.Interface
+
+	metrics         *Metrics
+	tracer          apitrace.Tracer
+	grpcDialOptions []grpc.DialOption // Options for connections to the gRPC API of the served model
+	portForwarder   PortForwarder
+	portForwardStop func() // Tears down the port-forward opened by a PortForward instruction
+	modelURL        string // Base URL of the model's REST API through the port-forward
+
+	// Guards created and the port-forward, which the instructions of a Parallel may change at the same time
+	mutex sync.Mutex
+
+	stopObserver func()        // Cancels the context the Deployer was started with
+	observerDone chan struct{} // Closed once Run of the Observer has returned
+	closed       bool
 }
 
-func NewDeployer(config *rest.Config, deployment *machinelearningv1.SeldonDeployment, debug bool) (deployer *Deployer, err error) {
-	if debug {
-		log.SetLevel(log.DebugLevel)
-	}
+// NewDeployer creates a Deployer for the deployment. Without any options, it creates its own client and Observer
+// from config, logs to DeployerLogger and gives every RunInstructions call DefaultTimeout to finish.
+func NewDeployer(config *rest.Config, deployment *machinelearningv1.SeldonDeployment, opts ...Option) (deployer *Deployer, err error) {
 	clientset, err := seldonclientset.NewForConfig(config)
 	if err != nil {
 		return deployer, errors.Wrapf(err, "could not create new Seldon ClientSet")
 	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return deployer, errors.Wrapf(err, "could not create new Kubernetes ClientSet")
+	}
+	opts = append([]Option{WithPortForwarder(SPDYPortForwarder(config))}, opts...)
+	return NewDeployerForClients(clientset, kubeClient, deployment, opts...)
+}
 
+// NewDeployerForClients creates a Deployer that talks to the cluster through the given clients, e.g. the fake
+// clientsets in tests. kubeClient is only used to watch the Kubernetes events of the deployment and to find the pods
+// to port-forward to, and may be nil.
+func NewDeployerForClients(clientset seldonclientset.Interface, kubeClient kubernetes.Interface,
+	deployment *machinelearningv1.SeldonDeployment, opts ...Option) (deployer *Deployer, err error) {
+	options := newOptions(opts)
+	logger := options.deployerLogger().WithField(ComponentField, "deployer")
+	if options.namespace != "" {
+		deployment = deployment.DeepCopy()
+		deployment.SetNamespace(options.namespace)
+	}
 	namespace := deployment.GetNamespace()
 	if namespace == "" {
 		namespace = v1.NamespaceDefault
-		log.Warn(ThisNeedsAttentionLog("namespace was not provided. Using default namespace"))
+		logger.Warn(ThisNeedsAttentionLog("namespace was not provided. Using default namespace"))
 	}
 	if deployment.GetObjectMeta().GetName() == "" {
-		return deployer, fmt.Errorf("deployment cannot have empty metadata.name")
+		return deployer, WithKind(ErrValidation, fmt.Errorf("deployment cannot have empty metadata.name"))
+	}
+	if options.timeout <= 0 {
+		return deployer, WithKind(ErrValidation, fmt.Errorf("timeout has to be positive, not %s", options.timeout))
 	}
 
-	client := clientset.MachinelearningV1().SeldonDeployments(namespace)
+	client := options.client
+	if client == nil {
+		client = clientset.MachinelearningV1().SeldonDeployments(namespace)
+	}
+	tracer := options.tracer()
+	client = &tracedClient{SeldonDeploymentInterface: client, tracer: tracer}
 
-	// TODO: Have separate loggers for Deployer and Observer?
-	log.Info("New deployment created...")
+	logger = logger.WithFields(deploymentFields(namespace, deployment.GetObjectMeta().GetName()))
+	logger.Info("New deployment created...")
 
 	deployer = &Deployer{
 		name:       deployment.GetObjectMeta().GetName(),
+		namespace:  namespace,
 		deployment: deployment,
 		client:     client,
-		eventChan:  make(chan Event),
 		replyChan:  make(chan error),
+		log:        logger,
+		timeout:    options.timeout,
+		dryRun:     options.dryRun,
+		recorder:   options.eventRecorder,
+		httpClient: options.httpClient,
+		kubeClient: kubeClient,
+
+		metrics:         options.metrics,
+		tracer:          tracer,
+		grpcDialOptions: options.grpcDialOpts,
+		portForwarder:   options.portForwarder,
 	}
 
-	deployer.observer = NewObserver(clientset)
+	deployer.observer = options.observer
+	if deployer.observer == nil {
+		deployer.observer = newObserver(clientset, kubeClient, options)
+	}
 	return deployer, nil
 }
 
 func (d *Deployer) RunInstructions(instructions []DeploymentInstruction) error {
-	ctx, cancelFunc := context.WithTimeout(context.Background(), 60*time.Second)
-	// This should mean that the observers which hold this context will gracefully exit once all instrructions
-	// have been executed
+	return d.RunInstructionsContext(context.Background(), instructions)
+}
+
+// RunInstructionsContext runs the instructions like RunInstructions, but stops between instructions once interrupt is
+// cancelled. The instruction in flight is still carried out and waited on, the remaining ones are skipped and an
+// ErrInterrupted error is returned. The deployment is not rolled back, as an interrupted run is handed over, e.g. to
+// the next leader.
+// Every call is a trace, with a span for each instruction.
+// Calls on the same Deployer must not overlap.
+func (d *Deployer) RunInstructionsContext(interrupt context.Context, instructions []DeploymentInstruction) (err error) {
+	if d.closed {
+		return WithKind(ErrValidation, fmt.Errorf("deployer has been closed"))
+	}
+	if d.observerDone == nil {
+		// The Observer keeps running for later calls, until the Deployer is closed
+		if err := d.Start(context.Background()); err != nil {
+			return err
+		}
+	}
+	// Events observed between runs are not effects of this run's instructions
+	d.events.clear()
+	ctx, cancelFunc := context.WithTimeout(context.Background(), d.timeout)
 	defer cancelFunc()
+	defer d.stopPortForward()
+	ctx, span := d.tracer.Start(ctx, "RunInstructions", apitrace.WithNewRoot(), apitrace.WithAttributes(
+		deploymentKey.String(d.name), namespaceKey.String(d.namespace), dryRunKey.Bool(d.dryRun)))
+	defer func() { endSpan(ctx, span, err) }()
 
-	d.observer.NotifyFunc = func(event Event) error {
-		return d.notifyFunc(ctx, event)
+	d.report = &Report{
+		Deployment:   d.name,
+		Namespace:    d.namespace,
+		Start:        time.Now(),
+		Instructions: make([]InstructionReport, len(instructions)),
 	}
-	d.observer.ErrorFunc = func() {
-		ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-		// Ignore error and just send delete call
-		deleteFinalizer := Delete{}
-		err := deleteFinalizer.Do(ctx, d)
-		log.Errorf("got an error while cleaning up: %s", err)
+	for i, instruction := range instructions {
+		d.report.Instructions[i] = newInstructionReport(instruction)
 	}
-	go d.observer.Run()
+	defer func() { d.report.End = time.Now() }()
 
-	log.Info(EventLog("Start running instructions"))
-	for _, instruction := range instructions {
-		err := d.executeInstruction(ctx, instruction)
+	if err := d.waitForObserver(ctx); err != nil {
+		return err
+	}
+	d.log.Info(EventLog("Start running instructions"))
+	for i, instruction := range instructions {
+		if interrupt.Err() != nil {
+			d.log.Warn(ThisNeedsAttentionLog("Run was interrupted. Skipping the remaining instructions"))
+			return WithKind(ErrInterrupted, errors.Wrapf(interrupt.Err(), "interrupted before instruction %s",
+				instructionName(instruction)))
+		}
+		err := d.executeInstruction(ctx, instruction, &d.report.Instructions[i])
 		if err != nil {
-			return err
+			return d.rollbackAfterFailure(ctx, err)
+		}
+	}
+	d.log.Info(EventLog("Instructions have been run successfully"))
+	return nil
+}
+
+// Start starts the Observer, which then passes on events until ctx is cancelled or the Deployer is closed. A Deployer
+// can only be started once. RunInstructions starts a Deployer that has not been started yet itself, but it is up to
+// the caller to close it.
+func (d *Deployer) Start(ctx context.Context) error {
+	if d.closed || d.observerDone != nil {
+		return WithKind(ErrValidation, fmt.Errorf("deployer has already been started"))
+	}
+	ctx, cancelFunc := context.WithCancel(ctx)
+	events := newEventQueue()
+	d.events = events
+	d.observer.SetNotifyFunc(func(event Event) error {
+		return d.notifyFunc(ctx, events, event)
+	})
+	if observer, ok := d.observer.(*ObserverV2); ok {
+		observer.ErrorFunc = func() {
+			if ctx.Err() != nil {
+				// The Deployer has been closed, so the notify loop was meant to stop
+				return
+			}
+			if err := d.rollback(apitrace.SpanFromContext(ctx)); err != nil {
+				d.log.WithError(err).Error("got an error while cleaning up")
+			}
 		}
 	}
-	log.Info(EventLog("Instructions have been run successfully"))
+	d.stopObserver = cancelFunc
+	d.observerDone = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		d.observer.Run()
+	}(d.observerDone)
+	if observer, ok := d.observer.(StoppableObserver); ok {
+		go func() {
+			<-ctx.Done()
+			observer.Stop()
+		}()
+	}
+	d.log.Debug("Deployer has been started")
 	return nil
 }
 
-func (d *Deployer) executeInstruction(ctx context.Context, instruction DeploymentInstruction) error {
-	err := instruction.Do(ctx, d)
+// Close stops the Observer and, if it is a StoppableObserver, waits for its Run to return, which for an ObserverV2 is
+// once its informers have stopped. Other Observers are stopped by the next event they pass on. A closed Deployer
+// cannot run instructions anymore.
+func (d *Deployer) Close() error {
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	if d.observerDone == nil {
+		return nil
+	}
+	d.stopObserver()
+	if _, ok := d.observer.(StoppableObserver); ok {
+		<-d.observerDone
+	}
+	d.log.Debug("Deployer has been closed")
+	return nil
+}
+
+// waitForObserver waits until the cache of a CachedObserver has synced, and takes the snapshot of the deployment
+func (d *Deployer) waitForObserver(ctx context.Context) error {
+	d.snapshot = nil
+	observer, cached := d.observer.(CachedObserver)
+	if !cached {
+		return nil
+	}
+	d.log.Debug("Waiting for the observer's cache to sync...")
+	if err := observer.WaitForCacheSync(ctx); err != nil {
+		return WithKind(ErrTimeout, err)
+	}
+	snapshot, err := observer.Cached(d.namespace, d.name)
+	if err != nil {
+		return errors.Wrap(err, "could not get the cached deployment")
+	}
+	d.snapshot = snapshot
+	if snapshot != nil {
+		d.log.WithField(ResourceVersionField, snapshot.ResourceVersion).Info("Deployment exists already")
+	}
+	return nil
+}
+
+// Snapshot returns the deployment as it was before the last RunInstructions call, or nil if it did not exist or the
+// Observer does not keep a cache
+func (d *Deployer) Snapshot() *machinelearningv1.SeldonDeployment {
+	return d.snapshot
+}
+
+// isStale returns whether an event does not tell anything about the effects of the instructions, because it repeats
+// the state of the snapshot, e.g. in the initial list of the informer. Events of other SeldonDeployments are not even
+// queued.
+func (d *Deployer) isStale(event Event) bool {
+	return event.Type != Deleted && d.snapshot != nil && event.Deployment.ResourceVersion == d.snapshot.ResourceVersion
+}
+
+// Report returns the report of the last RunInstructions call, or nil if no instructions have been run yet
+func (d *Deployer) Report() *Report {
+	return d.report
+}
+
+func (d *Deployer) executeInstruction(ctx context.Context, instruction DeploymentInstruction, report *InstructionReport) (err error) {
+	report.Start = time.Now()
+	ctx, span := d.tracer.Start(ctx, instructionName(instruction),
+		apitrace.WithAttributes(instructionKey.String(instructionName(instruction))))
+	defer func() {
+		span.SetAttributes(eventsConsumedKey.Int(report.EventsConsumed))
+		endSpan(ctx, span, err)
+	}()
+	defer func() {
+		report.End = time.Now()
+		report.Status = InstructionPassed
+		if err != nil {
+			report.Status = InstructionFailed
+			report.Error = err.Error()
+		}
+		d.metrics.instructionExecuted(instructionName(instruction), report)
+	}()
+
+	name := instructionName(instruction)
+	d.recordEvent(v1.EventTypeNormal, "InstructionStarted", "Started instruction %s", name)
+	defer func() {
+		if err != nil {
+			d.recordEvent(v1.EventTypeWarning, "InstructionFailed", "Instruction %s failed: %s", name, err)
+		} else {
+			d.recordEvent(v1.EventTypeNormal, "InstructionDone", "Instruction %s is done", name)
+		}
+	}()
+
+	err = instruction.Do(ctx, d)
+	report.DoDuration = Duration(time.Since(report.Start))
 	if err != nil {
-		return errors.Wrapf(err, "failed to carry out instruction")
+		return errors.Wrapf(classifyError(err), "failed to carry out instruction")
+	}
+	if d.dryRun {
+		// Nothing has changed in the cluster, so there are no events to wait for
+		report.DoneDuration = report.DoDuration
+		d.logFor(instruction).Info(MileStoneLog("Instruction has been dry run"))
+		return nil
 	}
-	err = d.waitForSpecificEvent(ctx, instruction.Done)
+	if waitsForEvents(instruction) {
+		report.EventsConsumed, err = d.waitForSpecificEvent(ctx, instruction.Done)
+	} else {
+		err = d.checkDone(instruction)
+	}
+	report.DoneDuration = Duration(time.Since(report.Start))
 	if err != nil {
-		return errors.Wrapf(err, "instruction error-ed before finishing")
+		return errors.Wrapf(classifyError(err), "instruction error-ed before finishing")
+	}
+	if _, create := instruction.(*Create); create {
+		d.metrics.becameAvailable(time.Duration(report.DoneDuration))
 	}
+	d.logFor(instruction).Info(MileStoneLog("Instruction is done"))
 	return nil
 }
 
-func (d *Deployer) notifyFunc(ctx context.Context, event Event) error {
+// recordEvent records a Kubernetes event on the deployment, if an event recorder was given
+func (d *Deployer) recordEvent(eventType, reason, messageFmt string, args ...interface{}) {
+	if d.recorder == nil {
+		return
+	}
+	d.recorder.Eventf(d.deployment, eventType, reason, messageFmt, args...)
+}
+
+// dryRunOption returns the DryRun value for the options of requests sent by instructions
+func (d *Deployer) dryRunOption() []string {
+	if d.dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+// rollbackAfterFailure deletes the deployment if this run created it, so that a failed run does not leave a
+// half rolled out deployment behind. The returned error is tagged with ErrRolledBack if the rollback happened.
+func (d *Deployer) rollbackAfterFailure(ctx context.Context, err error) error {
+	if !d.isCreated() {
+		return err
+	}
+	d.log.Warn(ThisNeedsAttentionLog("Instruction failed. Rolling back deployment..."))
+	if rollbackErr := d.rollback(apitrace.SpanFromContext(ctx)); rollbackErr != nil {
+		d.log.WithError(rollbackErr).Error("got an error while rolling back")
+		return err
+	}
+	return WithKind(ErrRolledBack, err)
+}
+
+// rollback deletes the deployment if it was created by this run. The request is traced as a child of span, but not
+// cancelled with the run, which may have timed out.
+func (d *Deployer) rollback(span apitrace.Span) error {
+	if !d.isCreated() {
+		return nil
+	}
+	ctx, cancelFunc := context.WithTimeout(apitrace.ContextWithSpan(context.Background(), span), 10*time.Second)
+	defer cancelFunc()
+	deleteFinalizer := Delete{}
+	return deleteFinalizer.Do(ctx, d)
+}
+
+// setCreated records whether the deployment has been created by this run, and so is to be rolled back if it fails
+func (d *Deployer) setCreated(created bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.created = created
+}
+
+func (d *Deployer) isCreated() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.created
+}
+
+// notifyFunc queues the events of the deployment for waitForSpecificEvent. It never blocks, so that a slow instruction
+// does not hold up the Observer. Once the Deployer has been closed, it returns an error to stop the Observer.
+func (d *Deployer) notifyFunc(ctx context.Context, events *eventQueue, event Event) error {
 	if event.Deployment == nil {
 		return fmt.Errorf("received an event with nil Deployment")
 	}
-	select {
-	case d.eventChan <- event:
-	case <-ctx.Done():
-		log.Errorf("received an event with nil Deployment")
-		return fmt.Errorf("deployment context cancelled")
+	if ctx.Err() != nil {
+		d.log.WithFields(eventFields(event)).Debug("Deployer has been closed. Stopping the observer")
+		return fmt.Errorf("deployer has been closed")
+	}
+	if event.Deployment.Namespace != d.namespace || event.Deployment.Name != d.name {
+		return nil
+	}
+	events.push(event)
+	return nil
+}
+
+// checkDone checks once whether an EventlessInstruction is done, with the deployment as it was given to the Deployer
+func (d *Deployer) checkDone(instruction DeploymentInstruction) error {
+	done, err := instruction.Done(Event{Deployment: d.deployment, Time: time.Now()})
+	if err != nil {
+		return err
+	}
+	if !done {
+		return fmt.Errorf("instruction is not done after it has been carried out")
 	}
 	return nil
 }
 
-func (d *Deployer) waitForSpecificEvent(ctx context.Context, condition func(Event) (bool, error)) error {
+// waitForSpecificEvent checks the condition against the deployment as currently cached, if the Observer keeps a cache,
+// so that a condition that already holds is satisfied straight away. It then consumes the events queued for ctx until
+// the condition is satisfied, and returns the number of events consumed.
+func (d *Deployer) waitForSpecificEvent(ctx context.Context, condition func(Event) (bool, error)) (eventsConsumed int, err error) {
+	ctx, span := d.tracer.Start(ctx, "WaitForEvent")
+	defer func() { endSpan(ctx, span, err) }()
+	events := d.eventsFor(ctx)
+	previousState := d.deployment.Status.State
+	if cached, ok := d.cachedEvent(); ok {
+		previousState = cached.Deployment.Status.State
+		d.log.WithFields(eventFields(cached)).Debug("Checking if cached deployment satisfies instruction")
+		conditionSatisfied, err := condition(cached)
+		if err != nil || conditionSatisfied {
+			return eventsConsumed, err
+		}
+	}
 	for {
-		select {
-		case event := <-d.eventChan:
+		for event, ok := events.pop(); ok; event, ok = events.pop() {
+			if d.isStale(event) {
+				d.log.WithFields(eventFields(event)).Debug("Skipping event that is not an effect of the instructions")
+				continue
+			}
+			eventsConsumed++
+			addEventToSpan(ctx, event, previousState)
+			previousState = event.Deployment.Status.State
+			d.log.WithFields(eventFields(event)).Debug("Checking if event satisfies instruction")
 			conditionSatisfied, err := condition(event)
 			if err != nil {
-				return err
+				return eventsConsumed, err
 			} else if conditionSatisfied {
-				return nil
+				return eventsConsumed, nil
 			}
+		}
+		select {
+		case <-events.pushed:
 		case <-ctx.Done():
-			return fmt.Errorf("context cancelled while trying to satisfy event condition")
+			return eventsConsumed, errors.Wrap(ctx.Err(), "context cancelled while trying to satisfy event condition")
+		}
+	}
+}
+
+// cachedEvent returns the deployment as currently cached by a CachedObserver as an Updated event, if it is cached
+func (d *Deployer) cachedEvent() (Event, bool) {
+	observer, cached := d.observer.(CachedObserver)
+	if !cached {
+		return Event{}, false
+	}
+	deploy, err := observer.Cached(d.namespace, d.name)
+	if err != nil {
+		d.log.WithError(err).Warn("could not get the cached deployment. Waiting for events instead")
+		return Event{}, false
+	}
+	if deploy == nil {
+		return Event{}, false
+	}
+	return Event{Deployment: deploy, Type: Updated, Time: time.Now()}, true
+}
+
+type eventsKey struct{}
+
+// withEvents makes the instructions carried out with ctx wait for the events of queue, e.g. those of a branch of a
+// Parallel, instead of those of the Deployer
+func withEvents(ctx context.Context, queue *eventQueue) context.Context {
+	return context.WithValue(ctx, eventsKey{}, queue)
+}
+
+// eventsFor returns the queue that the instructions carried out with ctx wait for events from
+func (d *Deployer) eventsFor(ctx context.Context) *eventQueue {
+	if queue, ok := ctx.Value(eventsKey{}).(*eventQueue); ok {
+		return queue
+	}
+	return d.events
+}
+
+// eventQueue buffers events in the order they were observed. Pushing never blocks. While a queue has branches, the
+// events pushed to it are passed on to each of them instead, so that instructions carried out at the same time each
+// see all events.
+type eventQueue struct {
+	mutex    sync.Mutex
+	events   []Event
+	branches map[*eventQueue]bool
+	pushed   chan struct{} // Receives once events have been pushed since it was last received from
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{pushed: make(chan struct{}, 1), branches: map[*eventQueue]bool{}}
+}
+
+func (q *eventQueue) push(event Event) {
+	q.mutex.Lock()
+	if len(q.branches) > 0 {
+		defer q.mutex.Unlock()
+		for branch := range q.branches {
+			branch.push(event)
 		}
+		return
+	}
+	q.events = append(q.events, event)
+	q.mutex.Unlock()
+	select {
+	case q.pushed <- struct{}{}:
+	default:
+	}
+}
+
+// branch returns a new queue that the events pushed to q are passed on to until it is removed again. The events that
+// have not been popped from q yet are passed on to it as well.
+func (q *eventQueue) branch() *eventQueue {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	branch := newEventQueue()
+	for _, event := range q.events {
+		branch.push(event)
+	}
+	q.branches[branch] = true
+	return branch
+}
+
+// removeBranch stops passing events on to branch. Once q has no branches left, it queues its events itself again. The
+// events it had queued before it had branches have been passed on to them, and so are dropped.
+func (q *eventQueue) removeBranch(branch *eventQueue) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.branches, branch)
+	if len(q.branches) == 0 {
+		q.events = nil
+	}
+}
+
+// clear drops the events that have not been popped yet
+func (q *eventQueue) clear() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.events = nil
+	select {
+	case <-q.pushed:
+	default:
+	}
+}
+
+// pop removes the oldest event, if there is any
+func (q *eventQueue) pop() (Event, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.events) == 0 {
+		return Event{}, false
 	}
+	event := q.events[0]
+	q.events[0] = Event{}
+	q.events = q.events[1:]
+	return event, true
+}
+
+// logFor returns the deployer's logger with the instruction attached as a field
+func (d *Deployer) logFor(instruction DeploymentInstruction) log.FieldLogger {
+	return d.log.WithField(InstructionField, instructionName(instruction))
 }
 
 func int32Ptr(i int32) *int32 {
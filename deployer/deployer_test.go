@@ -0,0 +1,458 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned/fake"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-client-k8s/deployertest"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	goruntime "runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+var seldonDeploymentsResource = schema.GroupResource{Group: "machinelearning.seldon.io", Resource: "seldondeployments"}
+
+// newTestDeployer returns a Deployer on top of a fake clientset with a simulated Seldon operator running, which stops
+// at the end of the test.
+func newTestDeployer(t *testing.T, operatorOpts []deployertest.OperatorOption, opts ...Option) (*Deployer, *fake.Clientset) {
+	clientset := deployertest.NewClientset()
+	operator := deployertest.NewOperator(clientset, operatorOpts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, operator.Start(ctx))
+	t.Cleanup(func() {
+		cancel()
+		operator.Wait()
+	})
+
+	logger, _ := test.NewNullLogger()
+	opts = append([]Option{WithTimeout(5 * time.Second), WithLogger(logger), WithObserverLogger(logger)}, opts...)
+	deployer, err := NewDeployerForClients(clientset, kubefake.NewSimpleClientset(), newTestDeployment(), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { deployer.Close() })
+	return deployer, clientset
+}
+
+func actionVerbs(clientset *fake.Clientset) []string {
+	var verbs []string
+	for _, action := range clientset.Actions() {
+		if action.GetResource().Resource == "seldondeployments" && action.GetVerb() != "list" && action.GetVerb() != "watch" {
+			verbs = append(verbs, action.GetVerb())
+		}
+	}
+	return verbs
+}
+
+func reportStatuses(report *Report) []InstructionStatus {
+	var statuses []InstructionStatus
+	for _, instruction := range report.Instructions {
+		statuses = append(statuses, instruction.Status)
+	}
+	return statuses
+}
+
+func TestDeployer_RunInstructions(t *testing.T) {
+	t.Run("create, scale and delete", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, nil)
+
+		err := deployer.RunInstructions([]DeploymentInstruction{
+			&Create{},
+			&ScaleReplicas{NumReplicas: 2},
+			&Delete{},
+		})
+		require.NoError(t, err)
+
+		verbs := actionVerbs(clientset)
+		assert.Equal(t, "create", verbs[0])
+		assert.Equal(t, "delete", verbs[len(verbs)-1])
+		assert.Equal(t, []InstructionStatus{InstructionPassed, InstructionPassed, InstructionPassed}, reportStatuses(deployer.Report()))
+		assert.False(t, deployer.created)
+	})
+
+	t.Run("scale waits for the replicas to be available", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, []deployertest.OperatorOption{deployertest.WithScaleDelay(200 * time.Millisecond)})
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}, &ScaleReplicas{NumReplicas: 3}}))
+		deployment, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Get(context.Background(), "seldon-deployment-example", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), deployment.Status.Replicas)
+		assert.True(t, deployer.Report().Instructions[1].DoneDuration > deployer.Report().Instructions[1].DoDuration+Duration(150*time.Millisecond))
+	})
+
+	t.Run("update waits for the new spec to be rolled out", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, []deployertest.OperatorOption{deployertest.WithCreateDelay(200 * time.Millisecond)})
+		require.NoError(t, deployer.Start(context.Background()))
+		defer deployer.Close()
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}}))
+		deployer.deployment.Spec.Annotations = map[string]string{"seldon.io/rest-timeout": "5000"}
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Update{}}))
+		assert.True(t, deployer.Report().Instructions[0].DoneDuration > Duration(150*time.Millisecond),
+			"the echo of the update is not taken for the deployment being available")
+	})
+
+	t.Run("scale retries on conflict", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, nil)
+		conflicts := 0
+		clientset.PrependReactor("update", "seldondeployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			replicas := action.(k8stesting.UpdateAction).GetObject().(*machinelearningv1.SeldonDeployment).Spec.Replicas
+			if replicas != nil && conflicts == 0 {
+				conflicts++
+				return true, nil, k8serrors.NewConflict(seldonDeploymentsResource, "seldon-deployment-example", fmt.Errorf("the object has been modified"))
+			}
+			return false, nil, nil
+		})
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}, &ScaleReplicas{NumReplicas: 3}}))
+		assert.Equal(t, 1, conflicts)
+		deployment, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Get(context.Background(), "seldon-deployment-example", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), *deployment.Spec.Replicas)
+	})
+
+	t.Run("rejected create is a validation error", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, nil)
+		clientset.PrependReactor("create", "seldondeployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, k8serrors.NewBadRequest("spec.predictors is required")
+		})
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&Create{}, &Delete{}})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrValidation))
+		assert.False(t, errors.Is(err, ErrRolledBack), "nothing was created, so nothing should be rolled back")
+		assert.Equal(t, []InstructionStatus{InstructionFailed, InstructionSkipped}, reportStatuses(deployer.Report()))
+	})
+
+	t.Run("failed scale rolls back the created deployment", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, nil)
+		clientset.PrependReactor("update", "seldondeployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.(k8stesting.UpdateAction).GetObject().(*machinelearningv1.SeldonDeployment).Spec.Replicas != nil {
+				return true, nil, k8serrors.NewInternalError(fmt.Errorf("etcd is unavailable"))
+			}
+			return false, nil, nil
+		})
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&Create{}, &ScaleReplicas{NumReplicas: 2}})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrRolledBack))
+		assert.True(t, errors.Is(err, ErrCluster))
+		assert.Equal(t, "delete", actionVerbs(clientset)[len(actionVerbs(clientset))-1])
+	})
+
+	t.Run("deployment that does not become available in time times out", func(t *testing.T) {
+		operatorOpts := []deployertest.OperatorOption{deployertest.WithCreateDelay(time.Second)}
+		deployer, _ := newTestDeployer(t, operatorOpts, WithTimeout(300*time.Millisecond))
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&Create{}})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrTimeout))
+		assert.True(t, errors.Is(err, ErrRolledBack))
+	})
+
+	t.Run("failed deployment is rolled back", func(t *testing.T) {
+		operatorOpts := []deployertest.OperatorOption{deployertest.WithFailure(deployertest.UnknownImage("seldonio/sklearn-iris:0.12"))}
+		deployer, clientset := newTestDeployer(t, operatorOpts)
+		deployer.deployment.Spec.Predictors = []machinelearningv1.PredictorSpec{{
+			Name: "default",
+			ComponentSpecs: []*machinelearningv1.SeldonPodSpec{{
+				Spec: v1.PodSpec{Containers: []v1.Container{{Image: "seldonio/sklearn-iris:0.1"}}},
+			}},
+		}}
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&Create{}, &Delete{}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Failed to pull image seldonio/sklearn-iris:0.1")
+		assert.True(t, errors.Is(err, ErrCluster))
+		assert.True(t, errors.Is(err, ErrRolledBack))
+		assert.Equal(t, "delete", actionVerbs(clientset)[len(actionVerbs(clientset))-1])
+	})
+
+	t.Run("delete waits for the deployment to be removed", func(t *testing.T) {
+		operatorOpts := []deployertest.OperatorOption{deployertest.WithDeleteDelay(200 * time.Millisecond)}
+		deployer, _ := newTestDeployer(t, operatorOpts)
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}, &Delete{}}))
+		deleteReport := deployer.Report().Instructions[1]
+		assert.True(t, time.Duration(deleteReport.DoneDuration) >= 200*time.Millisecond)
+		assert.Equal(t, 2, deleteReport.EventsConsumed, "should see the deployment terminating before it is deleted")
+	})
+
+	t.Run("dry run does not wait for events", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, nil, WithDryRun())
+		clientset.PrependReactor("*", "seldondeployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			switch action.GetVerb() {
+			case "create", "update", "delete":
+				return true, nil, nil
+			case "get":
+				return true, nil, k8serrors.NewNotFound(seldonDeploymentsResource, "seldon-deployment-example")
+			}
+			return false, nil, nil
+		})
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&Create{}, &ScaleReplicas{NumReplicas: 2}, &Delete{}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"create", "get", "delete"}, actionVerbs(clientset))
+		assert.False(t, deployer.created)
+	})
+}
+
+// interruptingInstruction interrupts the run while it is being carried out
+type interruptingInstruction struct {
+	interrupt func()
+}
+
+func (i *interruptingInstruction) Eventless() {}
+
+func (i *interruptingInstruction) Do(ctx context.Context, d *Deployer) error {
+	i.interrupt()
+	return nil
+}
+
+func (i *interruptingInstruction) Done(event Event) (bool, error) {
+	return true, nil
+}
+
+func TestDeployer_RunInstructionsContext(t *testing.T) {
+	deployer, clientset := newTestDeployer(t, nil)
+	interrupt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := deployer.RunInstructionsContext(interrupt, []DeploymentInstruction{&Create{}, &interruptingInstruction{cancel}, &Delete{}})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrInterrupted))
+	assert.False(t, errors.Is(err, ErrRolledBack), "an interrupted run should be handed over, not rolled back")
+	assert.Equal(t, []InstructionStatus{InstructionPassed, InstructionPassed, InstructionSkipped}, reportStatuses(deployer.Report()))
+	assert.NotContains(t, actionVerbs(clientset), "delete")
+}
+
+func TestDeployer_RunInstructions_CacheSync(t *testing.T) {
+	t.Run("events of other deployments are skipped", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, []deployertest.OperatorOption{deployertest.WithCreateDelay(200 * time.Millisecond)})
+		other := newTestDeployment()
+		other.Name = "other"
+		other.Status.State = machinelearningv1.StatusStateAvailable
+		_, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Create(context.Background(), other, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}}))
+		assert.Nil(t, deployer.Snapshot())
+		deployment, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Get(context.Background(), "seldon-deployment-example", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, machinelearningv1.StatusStateAvailable, deployment.Status.State)
+	})
+
+	t.Run("snapshot of an existing deployment", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, nil)
+		existing := newTestDeployment()
+		existing.Status.State = machinelearningv1.StatusStateAvailable
+		existing.Status.Replicas = 1 // So that the operator leaves it as it is
+		existing, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Create(context.Background(), existing, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Delete{}}))
+		require.NotNil(t, deployer.Snapshot())
+		assert.Equal(t, existing.ResourceVersion, deployer.Snapshot().ResourceVersion)
+		assert.Equal(t, 1, deployer.Report().Instructions[0].EventsConsumed, "only the Deleted event is an effect of Delete")
+	})
+}
+
+func TestDeployer_RunInstructions_CachedState(t *testing.T) {
+	deployer, clientset := newTestDeployer(t, nil, WithTimeout(time.Second))
+	existing := newTestDeployment()
+	existing.Spec.Replicas = int32Ptr(3)
+	existing.Status.State = machinelearningv1.StatusStateAvailable
+	existing.Status.Replicas = 3
+	_, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Create(context.Background(), existing, metav1.CreateOptions{})
+	require.NoError(t, err)
+	// Like the API server, an update that does not change anything is not written, so there is no event to wait for
+	clientset.PrependReactor("update", "seldondeployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		stored, err := clientset.Tracker().Get(action.GetResource(), action.GetNamespace(), "seldon-deployment-example")
+		return true, stored, err
+	})
+
+	require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&ScaleReplicas{NumReplicas: 3}}))
+	assert.Equal(t, 0, deployer.Report().Instructions[0].EventsConsumed, "the cached deployment is scaled already")
+}
+
+func TestDeployer_StartClose(t *testing.T) {
+	t.Run("several runs on one started deployer", func(t *testing.T) {
+		deployer, clientset := newTestDeployer(t, nil)
+		require.NoError(t, deployer.Start(context.Background()))
+		defer deployer.Close()
+		assert.Error(t, deployer.Start(context.Background()), "a deployer can only be started once")
+
+		for _, instructions := range [][]DeploymentInstruction{{&Create{}}, {&ScaleReplicas{NumReplicas: 2}}, {&Delete{}}} {
+			require.NoError(t, deployer.RunInstructions(instructions))
+			assert.Equal(t, []InstructionStatus{InstructionPassed}, reportStatuses(deployer.Report()))
+		}
+		verbs := actionVerbs(clientset)
+		assert.Equal(t, "create", verbs[0])
+		assert.Equal(t, "delete", verbs[len(verbs)-1])
+
+		require.NoError(t, deployer.Close())
+		assert.Error(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}}), "a closed deployer cannot run instructions")
+	})
+
+	t.Run("a run starts the deployer and leaves it running", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, nil)
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}}))
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Delete{}}))
+		assert.Error(t, deployer.Start(context.Background()), "the first run has started the deployer")
+		require.NoError(t, deployer.Close())
+	})
+
+	t.Run("close stops informers and goroutines", func(t *testing.T) {
+		clientset := deployertest.NewClientset()
+		operator := deployertest.NewOperator(clientset)
+		ctx, cancel := context.WithCancel(context.Background())
+		require.NoError(t, operator.Start(ctx))
+		defer func() {
+			cancel()
+			operator.Wait()
+		}()
+		logger, _ := test.NewNullLogger()
+		deployer, err := NewDeployerForClients(clientset, kubefake.NewSimpleClientset(), newTestDeployment(),
+			WithTimeout(5*time.Second), WithLogger(logger), WithObserverLogger(logger))
+		require.NoError(t, err)
+
+		before := deployerGoroutines()
+		require.NoError(t, deployer.Start(context.Background()))
+		for i := 0; i < 3; i++ {
+			require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}, &Delete{}}))
+		}
+		informers := []string{"(*sharedIndexInformer).Run", "(*processorListener)", "(*ObserverV2)"}
+		assert.NotEmpty(t, startedGoroutines(before, informers...), "the observer is running")
+		require.NoError(t, deployer.Close())
+		assert.Empty(t, startedGoroutines(before, informers...), "close waits for the informers to stop")
+
+		// Goroutines that are done may take a moment to exit, e.g. the one closing the queue of an informer
+		leaked := startedGoroutines(before)
+		for deadline := time.Now().Add(time.Second); len(leaked) > 0 && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			leaked = startedGoroutines(before)
+		}
+		assert.Empty(t, leaked, "goroutines leaked")
+	})
+}
+
+// deployerGoroutines returns the stacks of the running goroutines of the deployer package and of informers by the ID
+// of the goroutine. The goroutines of the tests and of the simulated operator are left out.
+func deployerGoroutines() map[string]string {
+	buf := make([]byte, 1<<16)
+	n := goruntime.Stack(buf, true)
+	for n == len(buf) {
+		buf = make([]byte, 2*len(buf))
+		n = goruntime.Stack(buf, true)
+	}
+	goroutines := map[string]string{}
+	for _, stack := range strings.Split(string(buf[:n]), "\n\n") {
+		if strings.Contains(stack, "go-client-k8s/deployer.Test") {
+			continue
+		}
+		if strings.Contains(stack, "go-client-k8s/deployer.") || strings.Contains(stack, "k8s.io/client-go/tools/cache.") {
+			goroutines[strings.Fields(stack)[1]] = stack
+		}
+	}
+	return goroutines
+}
+
+// startedGoroutines returns the stacks of the goroutines of deployerGoroutines that are not in before. If functions are
+// given, only those of goroutines running any of them are returned.
+func startedGoroutines(before map[string]string, functions ...string) []string {
+	var started []string
+	for id, stack := range deployerGoroutines() {
+		if _, ok := before[id]; ok {
+			continue
+		}
+		running := len(functions) == 0
+		for _, function := range functions {
+			running = running || strings.Contains(stack, function)
+		}
+		if running {
+			started = append(started, stack)
+		}
+	}
+	return started
+}
+
+func TestDeployer_NotifyLoopFailure(t *testing.T) {
+	deployer, clientset := newTestDeployer(t, nil)
+	require.NoError(t, deployer.Start(context.Background()))
+	defer deployer.Close()
+	require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}}))
+
+	// The observer calls its ErrorFunc when the notify loop fails while the Deployer is still running
+	deployer.observer.(*ObserverV2).ErrorFunc()
+	_, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Get(context.Background(),
+		"seldon-deployment-example", metav1.GetOptions{})
+	assert.True(t, k8serrors.IsNotFound(err), "the created deployment should have been cleaned up")
+}
+
+func TestEventQueue(t *testing.T) {
+	queue := newEventQueue()
+	_, ok := queue.pop()
+	assert.False(t, ok)
+
+	for _, eventType := range []EventType{Added, Updated, Deleted} {
+		queue.push(Event{Type: eventType})
+	}
+	select {
+	case <-queue.pushed:
+	default:
+		t.Fatal("pushing should signal that there are events")
+	}
+	for _, eventType := range []EventType{Added, Updated, Deleted} {
+		event, ok := queue.pop()
+		require.True(t, ok)
+		assert.Equal(t, eventType, event.Type)
+	}
+	_, ok = queue.pop()
+	assert.False(t, ok)
+
+	queue.push(Event{Type: Added})
+	queue.clear()
+	_, ok = queue.pop()
+	assert.False(t, ok)
+	select {
+	case <-queue.pushed:
+		t.Fatal("clearing should drop the signal of the cleared events")
+	default:
+	}
+}
+
+func TestEventQueue_branch(t *testing.T) {
+	queue := newEventQueue()
+	queue.push(Event{Type: Added})
+	first, second := queue.branch(), queue.branch()
+	queue.push(Event{Type: Updated})
+
+	for _, branch := range []*eventQueue{first, second} {
+		for _, eventType := range []EventType{Added, Updated} {
+			event, ok := branch.pop()
+			require.True(t, ok)
+			assert.Equal(t, eventType, event.Type, "every branch gets every event")
+		}
+	}
+
+	queue.removeBranch(first)
+	queue.push(Event{Type: Updated})
+	_, ok := first.pop()
+	assert.False(t, ok, "a removed branch gets no events anymore")
+	_, ok = second.pop()
+	assert.True(t, ok)
+	queue.removeBranch(second)
+	queue.push(Event{Type: Deleted})
+	event, ok := queue.pop()
+	require.True(t, ok)
+	assert.Equal(t, Deleted, event.Type, "the events passed on before are not queued again")
+}
@@ -0,0 +1,129 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"go-client-k8s/parse"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DesiredSource provides the SeldonDeployments a Controller reconciles the cluster toward. It is read again every
+// resync period, so changes to the desired set are picked up without restarting the controller.
+type DesiredSource interface {
+	Desired(ctx context.Context) ([]*machinelearningv1.SeldonDeployment, error)
+	String() string
+}
+
+// isManifest returns whether a file or ConfigMap key holds a SeldonDeployment manifest, judging by its extension
+func isManifest(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// unmarshalManifests parses the manifest of every name, in the order of the names, and fails on manifests that cannot
+// be parsed or that describe the same SeldonDeployment twice
+func unmarshalManifests(manifests map[string][]byte) ([]*machinelearningv1.SeldonDeployment, error) {
+	names := make([]string, 0, len(manifests))
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := map[string]string{}
+	deployments := make([]*machinelearningv1.SeldonDeployment, 0, len(names))
+	for _, name := range names {
+		deployment, err := parse.UnmarshalSeldonDeployment(manifests[name])
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse manifest '%s'", name)
+		}
+		if deployment.GetName() == "" {
+			return nil, fmt.Errorf("manifest '%s' has an empty metadata.name", name)
+		}
+		key := deployment.GetNamespace() + "/" + deployment.GetName()
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("manifests '%s' and '%s' both describe %s", other, name, deployment.GetName())
+		}
+		seen[key] = name
+		deployments = append(deployments, deployment)
+	}
+	return deployments, nil
+}
+
+type directorySource struct {
+	dir string
+}
+
+// DirectorySource returns a DesiredSource that reads the .yaml, .yml and .json manifests in dir. Subdirectories and
+// other files are ignored.
+func DirectorySource(dir string) DesiredSource {
+	return &directorySource{dir: dir}
+}
+
+func (s *directorySource) Desired(ctx context.Context) ([]*machinelearningv1.SeldonDeployment, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read manifests directory '%s'", s.dir)
+	}
+	manifests := map[string][]byte{}
+	for _, file := range files {
+		if file.IsDir() || !isManifest(file.Name()) {
+			continue
+		}
+		path := filepath.Join(s.dir, file.Name())
+		rawData, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read manifest '%s'", path)
+		}
+		manifests[path] = rawData
+	}
+	return unmarshalManifests(manifests)
+}
+
+func (s *directorySource) String() string {
+	return fmt.Sprintf("directory %s", s.dir)
+}
+
+type configMapSource struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// ConfigMapSource returns a DesiredSource that reads the manifests in the keys of a ConfigMap that end in .yaml, .yml
+// or .json, e.g. one created with `kubectl create configmap --from-file`
+func ConfigMapSource(client kubernetes.Interface, namespace, name string) DesiredSource {
+	return &configMapSource{client: client, namespace: namespace, name: name}
+}
+
+func (s *configMapSource) Desired(ctx context.Context) ([]*machinelearningv1.SeldonDeployment, error) {
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get ConfigMap %s/%s", s.namespace, s.name)
+	}
+	manifests := map[string][]byte{}
+	for key, value := range configMap.Data {
+		if isManifest(key) {
+			manifests[key] = []byte(value)
+		}
+	}
+	for key, value := range configMap.BinaryData {
+		if isManifest(key) {
+			manifests[key] = value
+		}
+	}
+	return unmarshalManifests(manifests)
+}
+
+func (s *configMapSource) String() string {
+	return fmt.Sprintf("ConfigMap %s/%s", s.namespace, s.name)
+}
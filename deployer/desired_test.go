@@ -0,0 +1,90 @@
+package deployer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const modelAManifest = `apiVersion: machinelearning.seldon.io/v1
+kind: SeldonDeployment
+metadata:
+  name: model-a
+  namespace: seldon
+spec:
+  replicas: 1
+  predictors:
+  - name: default
+    graph:
+      name: classifier
+`
+
+const modelBManifest = `{"apiVersion":"machinelearning.seldon.io/v1","kind":"SeldonDeployment","metadata":{"name":"model-b"},"spec":{"replicas":2}}`
+
+func writeManifest(t *testing.T, dir, name, manifest string) {
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(manifest), 0644))
+}
+
+func TestDirectorySource(t *testing.T) {
+	dir := t.TempDir()
+	writeManifest(t, dir, "model-a.yaml", modelAManifest)
+	writeManifest(t, dir, "model-b.json", modelBManifest)
+	writeManifest(t, dir, "README.md", "not a manifest")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "old.yaml"), 0755))
+
+	deployments, err := DirectorySource(dir).Desired(context.Background())
+	require.NoError(t, err)
+	require.Len(t, deployments, 2)
+	assert.Equal(t, "model-a", deployments[0].Name)
+	assert.Equal(t, "seldon", deployments[0].Namespace)
+	assert.Equal(t, "classifier", deployments[0].Spec.Predictors[0].Graph.Name)
+	assert.Equal(t, "model-b", deployments[1].Name)
+	assert.Equal(t, int32(2), *deployments[1].Spec.Replicas)
+
+	t.Run("same deployment twice", func(t *testing.T) {
+		writeManifest(t, dir, "model-a-copy.yml", modelAManifest)
+		defer os.Remove(filepath.Join(dir, "model-a-copy.yml"))
+
+		_, err := DirectorySource(dir).Desired(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "both describe model-a")
+	})
+
+	t.Run("invalid manifest", func(t *testing.T) {
+		writeManifest(t, dir, "broken.yaml", "metadata: [")
+		defer os.Remove(filepath.Join(dir, "broken.yaml"))
+
+		_, err := DirectorySource(dir).Desired(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "broken.yaml")
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := DirectorySource(filepath.Join(dir, "missing")).Desired(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigMapSource(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "desired", Namespace: "seldon"},
+		Data:       map[string]string{"model-a.yaml": modelAManifest, "owner": "ml-platform"},
+		BinaryData: map[string][]byte{"model-b.json": []byte(modelBManifest)},
+	})
+
+	deployments, err := ConfigMapSource(kubeClient, "seldon", "desired").Desired(context.Background())
+	require.NoError(t, err)
+	require.Len(t, deployments, 2)
+	assert.Equal(t, "model-a", deployments[0].Name)
+	assert.Equal(t, "model-b", deployments[1].Name)
+
+	_, err = ConfigMapSource(kubeClient, "seldon", "missing").Desired(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package deployer
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Error kinds that callers can test for with errors.Is to decide how a run has failed.
+var (
+	ErrValidation  = errors.New("validation error")
+	ErrTimeout     = errors.New("timed out")
+	ErrCluster     = errors.New("cluster error")
+	ErrRolledBack  = errors.New("rolled back")
+	ErrInterrupted = errors.New("interrupted")
+)
+
+// kindError tags an error with one of the error kinds above without changing its message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// WithKind tags err with one of the error kinds above, keeping its message as is
+func WithKind(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// classifyError tags err with the most fitting error kind, unless it has already been tagged
+func classifyError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrValidation), errors.Is(err, ErrTimeout), errors.Is(err, ErrCluster):
+		return err
+	}
+	// The Kubernetes API error checks do not unwrap errors
+	cause := errors.Cause(err)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), k8serrors.IsTimeout(cause), k8serrors.IsServerTimeout(cause):
+		return WithKind(ErrTimeout, err)
+	case k8serrors.IsInvalid(cause), k8serrors.IsBadRequest(cause):
+		return WithKind(ErrValidation, err)
+	default:
+		return WithKind(ErrCluster, err)
+	}
+}
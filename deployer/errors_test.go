@@ -0,0 +1,45 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	resource := schema.GroupResource{Group: "machinelearning.seldon.io", Resource: "seldondeployments"}
+
+	t.Run("timeout", func(t *testing.T) {
+		err := classifyError(errors.Wrap(context.DeadlineExceeded, "waiting"))
+		assert.True(t, errors.Is(err, ErrTimeout))
+		assert.Equal(t, "waiting: context deadline exceeded", err.Error())
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		invalid := k8serrors.NewInvalid(schema.GroupKind{Kind: "SeldonDeployment"}, "example", field.ErrorList{})
+		assert.True(t, errors.Is(classifyError(invalid), ErrValidation))
+	})
+
+	t.Run("cluster", func(t *testing.T) {
+		err := classifyError(k8serrors.NewNotFound(resource, "example"))
+		assert.True(t, errors.Is(err, ErrCluster))
+		assert.False(t, errors.Is(err, ErrTimeout))
+	})
+
+	t.Run("already classified", func(t *testing.T) {
+		err := classifyError(errors.Wrap(WithKind(ErrValidation, fmt.Errorf("bad")), "wrapped"))
+		assert.True(t, errors.Is(err, ErrValidation))
+		assert.False(t, errors.Is(err, ErrCluster))
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		err := WithKind(ErrRolledBack, classifyError(context.DeadlineExceeded))
+		assert.True(t, errors.Is(err, ErrRolledBack))
+		assert.True(t, errors.Is(err, ErrTimeout))
+	})
+}
@@ -0,0 +1,73 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"go-client-k8s/predict"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// DefaultExecutorGRPCPort is the port of the gRPC API of the Seldon executor in predictor pods
+const DefaultExecutorGRPCPort = 5001
+
+// grpcTarget returns the address of the model's gRPC API to dial, the same way predictionsURL picks the endpoint. URLs
+// may be given with or without a scheme. Behind the ingress, requests are routed by metadata instead of by path.
+func grpcTarget(d *Deployer, baseURL, ingressURL string) (string, metadata.MD, error) {
+	forwardedURL := d.forwardedURL()
+	switch {
+	case baseURL != "":
+		return predict.GRPCTarget(baseURL), nil, nil
+	case ingressURL != "":
+		return predict.GRPCTarget(ingressURL), predict.IngressMetadata(d.namespace, d.name), nil
+	case forwardedURL != "":
+		return predict.GRPCTarget(forwardedURL), nil, nil
+	}
+	return "", nil, WithKind(ErrValidation,
+		fmt.Errorf("sending requests to the model needs a base URL, an ingress URL or an earlier PortForward"))
+}
+
+// dialModel connects to the model's gRPC API and returns a client for the protocol the deployment declares, together
+// with the context requests are to be sent with
+func dialModel(ctx context.Context, d *Deployer, baseURL, ingressURL string) (*predict.GRPCClient, *grpc.ClientConn, context.Context, error) {
+	target, md, err := grpcTarget(d, baseURL, ingressURL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	conn, err := grpc.DialContext(ctx, target, d.grpcDialOptions...)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "could not dial %s", target)
+	}
+	client, err := predict.NewGRPCClient(conn, predict.ProtocolOf(d.deployment), predict.ModelName(d.deployment))
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, WithKind(ErrValidation, err)
+	}
+	if md != nil {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	return client, conn, ctx, nil
+}
+
+// sendGRPCPrediction sends a payload written in the protocol's JSON to the model over gRPC. Failures are recorded in
+// the result, with the gRPC status in place of the HTTP status code.
+func sendGRPCPrediction(ctx context.Context, client *predict.GRPCClient, payload Payload) (result PredictionResult) {
+	result.Line = payload.Line
+	start := time.Now()
+	defer func() { result.Latency = Duration(time.Since(start)) }()
+
+	response, err := client.PredictJSON(ctx, payload.Body)
+	if err != nil {
+		if s, ok := status.FromError(errors.Cause(err)); ok {
+			result.Error = s.Code().String() + ": " + s.Message()
+			return result
+		}
+		result.Error = err.Error()
+		return result
+	}
+	result.Response = response
+	return result
+}
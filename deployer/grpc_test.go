@@ -0,0 +1,101 @@
+package deployer
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-client-k8s/predict"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"net"
+	"testing"
+)
+
+// newSeldonGRPCServer starts an in-process stand-in for the gRPC API of a Seldon executor that fails requests with
+// strData, and returns the options to dial it with together with the metadata of every request it received
+func newSeldonGRPCServer(t *testing.T) ([]grpc.DialOption, *[]metadata.MD) {
+	var received []metadata.MD
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "seldon.protos.Seldon",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Predict",
+			Handler: func(_ interface{}, ctx context.Context, decode func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				received = append(received, md)
+				request := dynamicpb.NewMessage(predict.SeldonMessage)
+				if err := decode(request); err != nil {
+					return nil, err
+				}
+				if request.Has(predict.SeldonMessage.Fields().ByName("strData")) {
+					return nil, status.Error(codes.InvalidArgument, "strData is not supported")
+				}
+				response := dynamicpb.NewMessage(predict.SeldonMessage)
+				return response, protojson.Unmarshal([]byte(`{"data":{"ndarray":[[0.9,0.1]]}}`), response)
+			},
+		}},
+	}, struct{}{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.Dial() }),
+	}, &received
+}
+
+func TestDeployer_RunInstructions_PredictGRPC(t *testing.T) {
+	t.Run("sends the payloads over gRPC", func(t *testing.T) {
+		dialOptions, received := newSeldonGRPCServer(t)
+		deployer, _ := newTestDeployer(t, nil, WithGRPCDialOptions(dialOptions...))
+		deployer.deployment.Spec.Transport = "grpc"
+		instruction := &Predict{
+			RequestsFile: writeRequestsFile(t, `{"data":{"ndarray":[[1,2]]}}`, `{"strData":"hello"}`),
+			BaseURL:      "model:5001",
+			MaxErrorRate: 0.5,
+		}
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{instruction}))
+		require.Len(t, instruction.Results, 2)
+		assert.JSONEq(t, `{"data":{"ndarray":[[0.9,0.1]]}}`, string(instruction.Results[0].Response))
+		assert.True(t, instruction.Results[0].Latency > 0)
+		assert.Equal(t, "InvalidArgument: strData is not supported", instruction.Results[1].Error)
+		assert.Len(t, *received, 2)
+	})
+
+	t.Run("requests through the ingress are routed by metadata", func(t *testing.T) {
+		dialOptions, received := newSeldonGRPCServer(t)
+		deployer, _ := newTestDeployer(t, nil, WithGRPCDialOptions(dialOptions...))
+		deployer.deployment.Spec.Transport = "grpc"
+		instruction := &Predict{
+			RequestsFile: writeRequestsFile(t, `{"data":{"ndarray":[[1,2]]}}`),
+			IngressURL:   "http://localhost:8003",
+		}
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{instruction}))
+		require.Len(t, *received, 1)
+		assert.Equal(t, []string{"seldon-deployment-example"}, (*received)[0].Get("seldon"))
+		assert.Equal(t, []string{"seldon"}, (*received)[0].Get("namespace"))
+	})
+
+	t.Run("tensorflow protocol is a validation error", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, nil)
+		deployer.deployment.Spec.Transport = "grpc"
+		deployer.deployment.Spec.Protocol = predict.Tensorflow
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&Predict{
+			RequestsFile: writeRequestsFile(t, `{}`),
+			BaseURL:      "model:5001",
+		}})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrValidation))
+	})
+}
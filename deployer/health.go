@@ -0,0 +1,107 @@
+package deployer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HealthCheck returns an error if the component it checks is not healthy, or not ready
+type HealthCheck func() error
+
+// Health collects the liveness and readiness checks of Observers and Controllers, for the probes of the long-running
+// modes. Its handlers answer 200 if all checks pass, and 503 with the failed checks otherwise. A nil *Health checks
+// nothing.
+type Health struct {
+	mutex     sync.Mutex
+	liveness  map[string]HealthCheck
+	readiness map[string]HealthCheck
+}
+
+// NewHealth creates a Health without any checks
+func NewHealth() *Health {
+	return &Health{
+		liveness:  make(map[string]HealthCheck),
+		readiness: make(map[string]HealthCheck),
+	}
+}
+
+// AddLivenessCheck adds a check that fails once the process has to be restarted
+func (h *Health) AddLivenessCheck(name string, check HealthCheck) {
+	if h == nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.liveness[name] = check
+}
+
+// AddReadinessCheck adds a check that fails while the process cannot do its work yet
+func (h *Health) AddReadinessCheck(name string, check HealthCheck) {
+	if h == nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.readiness[name] = check
+}
+
+// Live runs the liveness checks, and returns an error naming the failed ones
+func (h *Health) Live() error {
+	if h == nil {
+		return nil
+	}
+	return h.run(h.liveness)
+}
+
+// Ready runs the readiness checks, and returns an error naming the failed ones
+func (h *Health) Ready() error {
+	if h == nil {
+		return nil
+	}
+	return h.run(h.readiness)
+}
+
+// LivenessHandler returns an HTTP handler for the liveness probe, e.g. at /healthz
+func (h *Health) LivenessHandler() http.Handler {
+	return healthHandler(h.Live)
+}
+
+// ReadinessHandler returns an HTTP handler for the readiness probe, e.g. at /readyz
+func (h *Health) ReadinessHandler() http.Handler {
+	return healthHandler(h.Ready)
+}
+
+func (h *Health) run(checks map[string]HealthCheck) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var failed []string
+	for _, name := range names {
+		if err := checks[name](); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func healthHandler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := check(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "failed: %s\n", err)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
@@ -0,0 +1,89 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-client-k8s/deployertest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	health := NewHealth()
+	failing := fmt.Errorf("not yet")
+	health.AddLivenessCheck("b", func() error { return nil })
+	health.AddReadinessCheck("c", func() error { return failing })
+	health.AddReadinessCheck("a", func() error { return failing })
+
+	assert.NoError(t, health.Live())
+	assert.EqualError(t, health.Ready(), "a: not yet, c: not yet")
+
+	recorder := httptest.NewRecorder()
+	health.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "failed: a: not yet, c: not yet\n", recorder.Body.String())
+
+	failing = nil
+	recorder = httptest.NewRecorder()
+	health.ReadinessHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "ok\n", recorder.Body.String())
+
+	var none *Health
+	none.AddLivenessCheck("a", func() error { return failing })
+	assert.NoError(t, none.Live())
+	assert.NoError(t, none.Ready())
+}
+
+func TestObserver_Health(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+
+	t.Run("ready once synced, and live until stopped", func(t *testing.T) {
+		clientset := deployertest.NewClientset()
+		health := NewHealth()
+		observer := NewObserver(clientset, nil, WithHealth(health), WithObserverLogger(logger))
+		notified := make(chan Event, 1)
+		observer.SetNotifyFunc(func(event Event) error {
+			notified <- event
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go observer.WaitTillContextIsCancelled(ctx)
+
+		assert.Error(t, health.Ready())
+		go observer.Run()
+		require.Eventually(t, func() bool { return health.Ready() == nil }, time.Second, 10*time.Millisecond)
+		assert.NoError(t, health.Live())
+
+		_, err := clientset.MachinelearningV1().SeldonDeployments("seldon").Create(context.Background(),
+			newTestDeployment(), metav1.CreateOptions{})
+		require.NoError(t, err)
+		<-notified
+		assert.NoError(t, health.Live())
+
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, health.Live(), "stopping the observer is not a failure")
+	})
+
+	t.Run("not live once the notify loop exited", func(t *testing.T) {
+		clientset := deployertest.NewClientset(newTestDeployment())
+		health := NewHealth()
+		observer := NewObserver(clientset, nil, WithHealth(health), WithObserverLogger(logger))
+		observer.SetNotifyFunc(func(Event) error { return fmt.Errorf("deployer has gone") })
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go observer.WaitTillContextIsCancelled(ctx)
+		go observer.Run()
+
+		require.Eventually(t, func() bool { return health.Live() != nil }, time.Second, 10*time.Millisecond)
+		assert.Contains(t, health.Live().Error(), "notify loop exited")
+	})
+}
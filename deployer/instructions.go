@@ -2,70 +2,240 @@ package deployer
 
 import (
 	"context"
+	"fmt"
 	"github.com/pkg/errors"
 	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
-	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/util/retry"
+	"strconv"
 )
 
 /*
 DeploymentInstruction provides an interface for describing instructions that required two distinct stages
 1. Do describes the actual instruction that is carried out by the deployer
 2. Done describes how events should be consumed in order to determine if the instruction has already been "done"
+Do can pass state to Done by keeping it on the instruction, e.g. the writeMark of its own write: Done is only called
+after Do has returned, from the same goroutine.
  */
 type DeploymentInstruction interface {
 	Do(context.Context, *Deployer) error
 	Done(event Event) (bool, error)
 }
 
+// EventlessInstruction is implemented by instructions that do not change the SeldonDeployment, e.g. because they
+// send requests to the served model, so there are no events to wait for. Their Done is checked once, straight after Do.
+type EventlessInstruction interface {
+	DeploymentInstruction
+	Eventless()
+}
+
 // TODO: These can be extended to be richer and contain more fields.
 // TODO: More instructions can be added as needed. The don't even need to be deployment instructions
 // e.g. Prompt? Or allow for model to be served, e.g. Serve?
-type Create struct{}
+type Create struct {
+	written writeMark
+}
 type Delete struct{}
 type ScaleReplicas struct {
 	count int
 	NumReplicas int32
+	By          int32 `json:",omitempty"` // Added to the current replicas instead of scaling to NumReplicas, if not 0
+
+	written writeMark
+	target  int32 // Replicas scaled to by Do
+}
+
+// Update replaces the spec of the existing deployment with the one given to the Deployer
+type Update struct {
+	written writeMark
+	changed bool                                     // Whether the write changed the spec
+	status  machinelearningv1.SeldonDeploymentStatus // Status as returned by the write
+	reacted bool                                     // Whether the operator has been seen reacting to the write
+}
+
+// writeMark records the SeldonDeployment as returned by the write of an instruction's Do, so that its Done only
+// accepts events at or after that write, rather than our own write echoed back or the state before it
+type writeMark struct {
+	resourceVersion string
+	generation      int64
+	reachedRV       bool // Whether the event of the write has been seen, if neither the generation nor the order of resourceVersions is known
+}
+
+func (w *writeMark) record(deploy *machinelearningv1.SeldonDeployment) {
+	*w = writeMark{}
+	if deploy != nil {
+		w.resourceVersion, w.generation = deploy.ResourceVersion, deploy.Generation
+	}
+}
+
+// reached returns whether deploy is at or after the write. Generations only grow, so they are compared when known.
+// Otherwise resourceVersions are compared as numbers, which they are with etcd. Clients should not rely on that though,
+// so if they are not, every event from the one with the written resourceVersion onwards is, as the events of the
+// informer are in order.
+func (w *writeMark) reached(deploy *machinelearningv1.SeldonDeployment) bool {
+	if w.generation > 0 && deploy.Generation > 0 {
+		return deploy.Generation >= w.generation
+	}
+	if w.resourceVersion == "" {
+		return true
+	}
+	written, writtenErr := strconv.ParseUint(w.resourceVersion, 10, 64)
+	current, currentErr := strconv.ParseUint(deploy.ResourceVersion, 10, 64)
+	if writtenErr == nil && currentErr == nil {
+		return current >= written
+	}
+	if deploy.ResourceVersion == w.resourceVersion {
+		w.reachedRV = true
+	}
+	return w.reachedRV
+}
+
+// replicasAvailable returns whether the status of every predictor shows replicas available. The deployments of
+// explainers are scaled separately, and so are not considered. Without any predictor status, the replicas of the
+// whole deployment are compared.
+func replicasAvailable(deploy *machinelearningv1.SeldonDeployment, replicas int32) bool {
+	predictors := 0
+	for _, status := range deploy.Status.DeploymentStatus {
+		if status.ExplainerFor != "" {
+			continue
+		}
+		predictors++
+		if status.Replicas != replicas || status.AvailableReplicas != replicas {
+			return false
+		}
+	}
+	if predictors == 0 {
+		return deploy.Status.State == machinelearningv1.StatusStateAvailable && deploy.Status.Replicas == replicas
+	}
+	return true
 }
 
 func (c *Create) Do(ctx context.Context, d *Deployer) error {
-	log.Info(ActionLog("Creating deployment..."))
-	_, err := d.client.Create(ctx, d.deployment, metav1.CreateOptions{})
+	d.logFor(c).Info(ActionLog("Creating deployment..."))
+	created, err := d.client.Create(ctx, d.deployment, metav1.CreateOptions{DryRun: d.dryRunOption()})
 	if err != nil {
 		return errors.Wrapf(err, "could not create deployment")
 	}
+	c.written.record(created)
+	d.setCreated(!d.dryRun)
 	return err
 }
 
 func (c *Create) Done(event Event) (bool, error) {
-	if event.Deployment.Status.State == machinelearningv1.StatusStateAvailable {
-		log.Info(MileStoneLog("Deployment is now available"))
+	if !c.written.reached(event.Deployment) {
+		return false, nil
+	}
+	switch event.Deployment.Status.State {
+	case machinelearningv1.StatusStateAvailable:
 		return true, nil
+	case machinelearningv1.StatusStateFailed:
+		return false, fmt.Errorf("deployment failed: %s", event.Deployment.Status.Description)
+	}
+	return false, nil
+}
+
+func (u *Update) Do(ctx context.Context, d *Deployer) error {
+	logger := d.logFor(u)
+	logger.Info(ActionLog("Updating deployment..."))
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		result, getErr := d.client.Get(ctx, d.name, metav1.GetOptions{})
+		if d.dryRun && k8serrors.IsNotFound(getErr) {
+			// The deployment may only have been created by an earlier dry run instruction
+			logger.Info("Deployment does not exist yet. Nothing to update in a dry run")
+			return nil
+		}
+		if getErr != nil {
+			return errors.Wrapf(getErr, "could not get current deployment %s", d.name)
+		}
+		result.Spec = *d.deployment.Spec.DeepCopy()
+		updated, updateErr := d.client.Update(ctx, result, metav1.UpdateOptions{DryRun: d.dryRunOption()})
+		if updateErr != nil {
+			// Returned as is, so that conflicts are retried like in ScaleReplicas
+			return updateErr
+		}
+		u.written.record(updated)
+		u.changed = updated.Generation != result.Generation
+		if updated.Generation == 0 {
+			u.changed = specDrifted(d.deployment.Spec, result.Spec)
+		}
+		u.status, u.reacted = *updated.Status.DeepCopy(), false
+		return nil
+	})
+	return errors.Wrap(err, "could not update deployment")
+}
+
+// Done waits until the deployment is available with the replicas of the updated spec. The status of a SeldonDeployment
+// has no observed generation, so if the update changed the spec, the deployment has to be seen leaving Available or
+// its status changing first. Otherwise the echo of the write would be taken for the deployment being available with
+// the new spec.
+func (u *Update) Done(event Event) (bool, error) {
+	deploy := event.Deployment
+	if !u.written.reached(deploy) {
+		return false, nil
+	}
+	if !u.reacted {
+		u.reacted = !u.changed || deploy.Status.State != machinelearningv1.StatusStateAvailable ||
+			!equality.Semantic.DeepEqual(deploy.Status, u.status)
+	}
+	switch deploy.Status.State {
+	case machinelearningv1.StatusStateAvailable:
+		if !u.reacted {
+			return false, nil
+		}
+		replicas := int32(1)
+		if deploy.Spec.Replicas != nil {
+			replicas = *deploy.Spec.Replicas
+		}
+		return replicasAvailable(deploy, replicas), nil
+	case machinelearningv1.StatusStateFailed:
+		return false, fmt.Errorf("deployment failed after the update: %s", deploy.Status.Description)
 	}
-	log.Info(EventLog("Deployment is not yet available"))
 	return false, nil
 }
 
 // TODO: Something doesn't seem right here. I've probably not done this right.
 func (s *ScaleReplicas) Do(ctx context.Context, d *Deployer) error {
-	log.Infof(ActionLog("Scaling replicas to %d...", s.NumReplicas))
+	logger := d.logFor(s)
+	if s.By != 0 {
+		logger.Info(ActionLog("Scaling replicas by %d...", s.By))
+	} else {
+		logger.Info(ActionLog("Scaling replicas to %d...", s.NumReplicas))
+	}
 	// This should not exit until either successful or non-conflict error occurs
 	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		result, getErr := d.client.Get(ctx, d.name, metav1.GetOptions{})
+		if d.dryRun && k8serrors.IsNotFound(getErr) {
+			// The deployment may only have been created by an earlier dry run instruction
+			logger.Info("Deployment does not exist yet. Nothing to scale in a dry run")
+			return nil
+		}
 		if getErr != nil {
 			return errors.Wrapf(getErr, "could not get current deployment %s", d.name)
 		}
-		result.Spec.Replicas = int32Ptr(s.NumReplicas)
-		_, updateErr := d.client.Update(ctx, result, metav1.UpdateOptions{})
+		s.target = s.NumReplicas
+		if s.By != 0 {
+			current := int32(1) // The default of the Seldon operator
+			if result.Spec.Replicas != nil {
+				current = *result.Spec.Replicas
+			}
+			s.target = current + s.By
+		}
+		result.Spec.Replicas = int32Ptr(s.target)
+		updated, updateErr := d.client.Update(ctx, result, metav1.UpdateOptions{DryRun: d.dryRunOption()})
 		if updateErr != nil {
-			log.Warnf("could not update deployment %s\n", d.name)
+			if k8serrors.IsConflict(updateErr) {
+				d.metrics.scaleConflict()
+			}
+			logger.WithError(updateErr).Warn("could not update deployment")
 			// Return the error as is because it implements the APIStatus interface and will allow for retries on conflict
 			// In particular, we expect the intermittent error: "Operation cannot be fulfilled on ... : the object has been modified; please apply your changes to the latest version and try again"
 			// This is because between client.Get and client.Update, the SeldonDeployment could be modified.
 			// Retrying ensures the latest SeldonDeployment is updated
 			return updateErr
 		}
+		s.written.record(updated)
 		return nil
 	})
 	if err != nil {
@@ -74,33 +244,44 @@ func (s *ScaleReplicas) Do(ctx context.Context, d *Deployer) error {
 	return nil
 }
 
+// Done waits until the replicas of the scaled spec are available, not just until the new spec is seen
 func (s *ScaleReplicas) Done(event Event) (bool, error) {
 	deploy := event.Deployment
-	if deploy.Spec.Replicas != nil {
-		if *deploy.Spec.Replicas == s.NumReplicas {
-			log.Info(MileStoneLog("Replicas have been scaled to %d", *deploy.Spec.Replicas))
-			return true, nil
-		}
+	if !s.written.reached(deploy) {
+		return false, nil
 	}
-	return false, nil
+	if deploy.Status.State == machinelearningv1.StatusStateFailed {
+		return false, fmt.Errorf("deployment failed while scaling: %s", deploy.Status.Description)
+	}
+	replicas := s.NumReplicas
+	if s.By != 0 {
+		replicas = s.target
+	}
+	if deploy.Spec.Replicas == nil || *deploy.Spec.Replicas != replicas {
+		return false, nil
+	}
+	return replicasAvailable(deploy, replicas), nil
 }
 
 func (d *Delete) Do(ctx context.Context, deploy *Deployer) error {
-	log.Info(ActionLog("Deleting deployment..."))
+	deploy.logFor(d).Info(ActionLog("Deleting deployment..."))
 	delPolicy := metav1.DeletePropagationBackground
 	delOptions := metav1.DeleteOptions{
 		PropagationPolicy: &delPolicy,
+		DryRun:            deploy.dryRunOption(),
+	}
+	err := deploy.client.Delete(ctx, deploy.name, delOptions)
+	if deploy.dryRun && k8serrors.IsNotFound(err) {
+		// The deployment may only have been created by an earlier dry run instruction
+		return nil
 	}
-	if err := deploy.client.Delete(ctx, deploy.name, delOptions); err != nil {
+	if err != nil {
 		return errors.Wrapf(err, "Failed to delete deployment")
 	}
+	deploy.setCreated(false)
 	return nil
 }
 
 func (d *Delete) Done(event Event) (bool, error) {
-	if event.Type == Deleted {
-		log.Info(MileStoneLog("Deployment has been deleted"))
-		return true, nil
-	}
-	return false, nil
+	return event.Type == Deleted, nil
 }
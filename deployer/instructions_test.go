@@ -0,0 +1,132 @@
+package deployer
+
+import (
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// scaledDeployment returns the test deployment at a generation, with the replicas of its spec and those available
+func scaledDeployment(generation int64, resourceVersion string, replicas, available int32) *machinelearningv1.SeldonDeployment {
+	deploy := newTestDeployment()
+	deploy.Generation = generation
+	deploy.ResourceVersion = resourceVersion
+	deploy.Spec.Replicas = int32Ptr(replicas)
+	deploy.Status.State = machinelearningv1.StatusStateAvailable
+	deploy.Status.DeploymentStatus = map[string]machinelearningv1.DeploymentStatus{
+		"seldon-deployment-example-default":   {Replicas: available, AvailableReplicas: available},
+		"seldon-deployment-example-explainer": {ExplainerFor: "seldon-deployment-example-default", Replicas: 1, AvailableReplicas: 1},
+	}
+	return deploy
+}
+
+func TestScaleReplicas_Done(t *testing.T) {
+	scale := &ScaleReplicas{NumReplicas: 3}
+	scale.written.record(scaledDeployment(2, "11", 3, 1))
+
+	for _, tc := range []struct {
+		name   string
+		deploy *machinelearningv1.SeldonDeployment
+		done   bool
+	}{
+		{"before the write", scaledDeployment(1, "10", 3, 3), false},
+		{"own write echoed back", scaledDeployment(2, "11", 3, 1), false},
+		{"replicas becoming available", scaledDeployment(2, "12", 3, 2), false},
+		{"replicas available", scaledDeployment(2, "13", 3, 3), true},
+		{"scaled again since", scaledDeployment(3, "14", 5, 3), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			done, err := scale.Done(Event{Deployment: tc.deploy, Type: Updated})
+			require.NoError(t, err)
+			assert.Equal(t, tc.done, done)
+		})
+	}
+
+	t.Run("failed deployment", func(t *testing.T) {
+		failed := scaledDeployment(2, "12", 3, 1)
+		failed.Status.State = machinelearningv1.StatusStateFailed
+		_, err := scale.Done(Event{Deployment: failed, Type: Updated})
+		assert.Error(t, err)
+	})
+}
+
+func TestUpdate_Done(t *testing.T) {
+	before := scaledDeployment(1, "10", 3, 3)
+	written := scaledDeployment(2, "11", 3, 3)
+
+	t.Run("changed spec", func(t *testing.T) {
+		update := &Update{changed: true, status: written.Status}
+		update.written.record(written)
+
+		updating := scaledDeployment(2, "12", 3, 3)
+		updating.Status.State = machinelearningv1.StatusStateCreating
+		for _, tc := range []struct {
+			name   string
+			deploy *machinelearningv1.SeldonDeployment
+			done   bool
+		}{
+			{"before the write", before, false},
+			{"own write echoed back", written, false},
+			{"rolling out", updating, false},
+			{"rolled out", scaledDeployment(2, "13", 3, 3), true},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				done, err := update.Done(Event{Deployment: tc.deploy, Type: Updated})
+				require.NoError(t, err)
+				assert.Equal(t, tc.done, done)
+			})
+		}
+	})
+
+	t.Run("status changed without leaving available", func(t *testing.T) {
+		update := &Update{changed: true, status: written.Status}
+		update.written.record(written)
+		done, err := update.Done(Event{Deployment: scaledDeployment(2, "12", 3, 3), Type: Updated})
+		require.NoError(t, err)
+		assert.False(t, done, "the status is the one the write returned")
+
+		done, err = update.Done(Event{Deployment: scaledDeployment(3, "13", 4, 4), Type: Updated})
+		require.NoError(t, err)
+		assert.True(t, done)
+	})
+
+	t.Run("unchanged spec", func(t *testing.T) {
+		update := &Update{status: before.Status}
+		update.written.record(before)
+		done, err := update.Done(Event{Deployment: before, Type: Updated})
+		require.NoError(t, err)
+		assert.True(t, done, "there is nothing to roll out")
+	})
+}
+
+func TestWriteMark(t *testing.T) {
+	t.Run("without generations, events from the write onwards", func(t *testing.T) {
+		var mark writeMark
+		mark.record(scaledDeployment(0, "11", 3, 1))
+		assert.False(t, mark.reached(scaledDeployment(0, "10", 3, 3)))
+		assert.True(t, mark.reached(scaledDeployment(0, "11", 3, 1)))
+		assert.True(t, mark.reached(scaledDeployment(0, "12", 3, 3)))
+	})
+
+	t.Run("without generations, older events after newer ones", func(t *testing.T) {
+		var mark writeMark
+		mark.record(scaledDeployment(0, "11", 3, 1))
+		assert.True(t, mark.reached(scaledDeployment(0, "12", 3, 3)), "the cached deployment")
+		assert.False(t, mark.reached(scaledDeployment(0, "10", 3, 3)), "an event queued before the write")
+	})
+
+	t.Run("without generations or numeric resource versions", func(t *testing.T) {
+		var mark writeMark
+		mark.record(scaledDeployment(0, "b", 3, 1))
+		assert.False(t, mark.reached(scaledDeployment(0, "a", 3, 3)))
+		assert.True(t, mark.reached(scaledDeployment(0, "b", 3, 1)))
+		assert.True(t, mark.reached(scaledDeployment(0, "c", 3, 3)))
+	})
+
+	t.Run("unknown write", func(t *testing.T) {
+		var mark writeMark
+		mark.record(nil)
+		assert.True(t, mark.reached(scaledDeployment(1, "10", 3, 3)))
+	})
+}
@@ -0,0 +1,150 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"os"
+	"time"
+)
+
+// Defaults of LeaderElection, the same as those of the Kubernetes controller manager
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewDeadline = 10 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+// LeaderElection describes the Lease that instances of a long-running mode, e.g. replicas of the controller, elect
+// their leader with
+type LeaderElection struct {
+	Client    kubernetes.Interface
+	Namespace string // Namespace of the Lease
+	Name      string // Name of the Lease
+	Identity  string // Identity of this instance, the hostname with a random suffix if not given
+
+	LeaseDuration time.Duration // How long other instances wait before taking over a Lease that is not renewed
+	RenewDeadline time.Duration // How long the leader keeps trying to renew the Lease before it stops leading
+	RetryPeriod   time.Duration // How long to wait between tries to acquire or renew the Lease
+}
+
+func (e LeaderElection) lock() (*resourcelock.LeaseLock, error) {
+	if e.Client == nil || e.Namespace == "" || e.Name == "" {
+		return nil, fmt.Errorf("leader election needs a Kubernetes client and the namespace and name of a Lease")
+	}
+	identity := e.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not get hostname for the leader election identity")
+		}
+		identity = hostname + "_" + string(uuid.NewUUID())
+	}
+	return &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: e.Namespace, Name: e.Name},
+		Client:     e.Client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}, nil
+}
+
+func durationOr(duration, fallback time.Duration) time.Duration {
+	if duration == 0 {
+		return fallback
+	}
+	return duration
+}
+
+// RunAsLeader waits until this instance holds the Lease of election, and then calls run. The context given to run
+// is cancelled when ctx is cancelled or the Lease is lost. The Lease is kept until run has returned, so that the work
+// in flight, e.g. the Done check of an instruction, is finished before another instance takes over, and released
+// straight afterwards. If ctx is cancelled before the Lease is acquired, run is never called and nil is returned.
+func RunAsLeader(ctx context.Context, election LeaderElection, run func(context.Context) error, opts ...Option) error {
+	options := newOptions(opts)
+	lock, err := election.lock()
+	if err != nil {
+		return WithKind(ErrValidation, err)
+	}
+	logger := options.deployerLogger().WithField(ComponentField, "leader-election").
+		WithField("lease", election.Namespace+"/"+election.Name).WithField("identity", lock.Identity())
+
+	// The election outlives ctx while run is in flight, so that the Lease is only released once run has returned
+	electionCtx, stopElection := context.WithCancel(context.Background())
+	defer stopElection()
+	started, runDone := make(chan struct{}), make(chan struct{})
+	var runErr error
+	// finished tells whether run returned while still leading, rather than because the Lease was lost. It is set
+	// before stopElection, as stopping the election cancels the context of run just like losing the Lease does
+	var finished bool
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   durationOr(election.LeaseDuration, DefaultLeaseDuration),
+		RenewDeadline:   durationOr(election.RenewDeadline, DefaultRenewDeadline),
+		RetryPeriod:     durationOr(election.RetryPeriod, DefaultRetryPeriod),
+		ReleaseOnCancel: true,
+		Name:            election.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				close(started)
+				logger.Info(MileStoneLog("Acquired lease. Started leading"))
+				runCtx, cancelRun := context.WithCancel(leaderCtx)
+				go func() {
+					select {
+					case <-ctx.Done():
+						logger.Info(EventLog("Stopping. Handing over once the work in flight is finished..."))
+					case <-runCtx.Done():
+					}
+					cancelRun()
+				}()
+				runErr = run(runCtx)
+				finished = leaderCtx.Err() == nil
+				cancelRun()
+				close(runDone)
+				stopElection()
+			},
+			OnStoppedLeading: func() {
+				logger.Info(EventLog("Stopped leading"))
+			},
+			OnNewLeader: func(identity string) {
+				if identity != lock.Identity() {
+					logger.Infof("Waiting for lease held by %s", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return WithKind(ErrValidation, errors.Wrap(err, "could not create leader elector"))
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			select {
+			case <-started:
+			default:
+				stopElection()
+			}
+		case <-started:
+		}
+	}()
+
+	logger.Info(ActionLog("Waiting to acquire lease..."))
+	elector.Run(electionCtx)
+	select {
+	case <-started:
+	default:
+		return nil
+	}
+	<-runDone
+	if finished {
+		return runErr
+	}
+	if runErr != nil {
+		return errors.Wrap(runErr, "lost lease while leading")
+	}
+	return WithKind(ErrCluster, fmt.Errorf("lost lease while leading"))
+}
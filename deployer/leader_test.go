@@ -0,0 +1,166 @@
+package deployer
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestElection(client kubernetes.Interface, identity string) LeaderElection {
+	return LeaderElection{
+		Client:        client,
+		Namespace:     "seldon",
+		Name:          "go-client-k8s",
+		Identity:      identity,
+		LeaseDuration: 2 * time.Second,
+		RenewDeadline: time.Second,
+		RetryPeriod:   50 * time.Millisecond,
+	}
+}
+
+// slowHook delays the entries with the given message, e.g. to let other goroutines run ahead of a callback that logs
+type slowHook struct {
+	message string
+	delay   time.Duration
+}
+
+func (h slowHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h slowHook) Fire(entry *logrus.Entry) error {
+	if strings.Contains(entry.Message, h.message) {
+		time.Sleep(h.delay)
+	}
+	return nil
+}
+
+func TestRunAsLeader(t *testing.T) {
+	logger, _ := test.NewNullLogger()
+
+	t.Run("only one instance runs, and hands over once its work is finished", func(t *testing.T) {
+		client := kubefake.NewSimpleClientset()
+		var mutex sync.Mutex
+		var steps []string
+		step := func(s string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			steps = append(steps, s)
+		}
+		leading := make(chan string, 2)
+		run := func(identity string) func(context.Context) error {
+			return func(ctx context.Context) error {
+				step(identity + " started")
+				leading <- identity
+				<-ctx.Done()
+				// Work in flight, e.g. waiting for the Done of an instruction, is finished before the lease is released
+				time.Sleep(200 * time.Millisecond)
+				step(identity + " finished")
+				return nil
+			}
+		}
+
+		ctxA, cancelA := context.WithCancel(context.Background())
+		ctxB, cancelB := context.WithCancel(context.Background())
+		defer cancelB()
+		results := make(chan error, 2)
+		go func() { results <- RunAsLeader(ctxA, newTestElection(client, "a"), run("a"), WithLogger(logger)) }()
+		require.Equal(t, "a", <-leading)
+		go func() { results <- RunAsLeader(ctxB, newTestElection(client, "b"), run("b"), WithLogger(logger)) }()
+
+		time.Sleep(200 * time.Millisecond)
+		cancelA()
+		select {
+		case leader := <-leading:
+			require.Equal(t, "b", leader)
+		case <-time.After(time.Second):
+			t.Fatal("b should take over before the lease expires, as a releases it")
+		}
+		require.NoError(t, <-results)
+		cancelB()
+		require.NoError(t, <-results)
+		assert.Equal(t, []string{"a started", "a finished", "b started", "b finished"}, steps)
+	})
+
+	t.Run("returns the error of run and releases the lease", func(t *testing.T) {
+		client := kubefake.NewSimpleClientset()
+		err := RunAsLeader(context.Background(), newTestElection(client, "a"), func(ctx context.Context) error {
+			return errors.New("instructions failed")
+		}, WithLogger(logger))
+		assert.EqualError(t, err, "instructions failed")
+
+		started := time.Now()
+		require.NoError(t, RunAsLeader(context.Background(), newTestElection(client, "b"), func(ctx context.Context) error {
+			return nil
+		}, WithLogger(logger)))
+		assert.True(t, time.Since(started) < time.Second)
+	})
+
+	t.Run("reports a lease lost while run is blocked on its context", func(t *testing.T) {
+		client := kubefake.NewSimpleClientset()
+		election := newTestElection(client, "a")
+		// run returns before the elector does, as it takes a while to report that it stopped leading
+		slowLogger, _ := test.NewNullLogger()
+		slowLogger.AddHook(slowHook{message: "Stopped leading", delay: 200 * time.Millisecond})
+		leading := make(chan struct{})
+		results := make(chan error, 1)
+		go func() {
+			results <- RunAsLeader(context.Background(), election, func(ctx context.Context) error {
+				close(leading)
+				<-ctx.Done()
+				return nil
+			}, WithLogger(slowLogger))
+		}()
+		<-leading
+
+		// Another instance takes the Lease over, so that a cannot renew it anymore
+		lease, err := client.CoordinationV1().Leases(election.Namespace).Get(context.Background(), election.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		identity, now := "b", metav1.NewMicroTime(time.Now())
+		lease.Spec.HolderIdentity, lease.Spec.AcquireTime, lease.Spec.RenewTime = &identity, &now, &now
+		_, err = client.CoordinationV1().Leases(election.Namespace).Update(context.Background(), lease, metav1.UpdateOptions{})
+		require.NoError(t, err)
+
+		select {
+		case err := <-results:
+			assert.EqualError(t, err, "lost lease while leading")
+			assert.True(t, errors.Is(err, ErrCluster))
+		case <-time.After(5 * time.Second):
+			t.Fatal("a should stop leading once it cannot renew the lease")
+		}
+	})
+
+	t.Run("does not run if cancelled before leading", func(t *testing.T) {
+		client := kubefake.NewSimpleClientset()
+		ctxA, cancelA := context.WithCancel(context.Background())
+		defer cancelA()
+		go RunAsLeader(ctxA, newTestElection(client, "a"), func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}, WithLogger(logger))
+		time.Sleep(200 * time.Millisecond)
+
+		ctxB, cancelB := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancelB()
+		ran := false
+		require.NoError(t, RunAsLeader(ctxB, newTestElection(client, "b"), func(ctx context.Context) error {
+			ran = true
+			return nil
+		}, WithLogger(logger)))
+		assert.False(t, ran)
+	})
+
+	t.Run("lease has to be named", func(t *testing.T) {
+		err := RunAsLeader(context.Background(), LeaderElection{Client: kubefake.NewSimpleClientset()},
+			func(ctx context.Context) error { return nil })
+		assert.True(t, errors.Is(err, ErrValidation))
+	})
+}
@@ -0,0 +1,223 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go-client-k8s/predict"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadTestSummary describes the requests sent by a LoadTest
+type LoadTestSummary struct {
+	Requests   int            `json:"requests"`
+	Failed     int            `json:"failed"`
+	Elapsed    Duration       `json:"elapsedSeconds"`
+	Throughput float64        `json:"throughput"` // Requests per second
+	P50        Duration       `json:"p50Seconds"` // Latency percentiles of the successful requests
+	P90        Duration       `json:"p90Seconds"`
+	P99        Duration       `json:"p99Seconds"`
+	Errors     map[string]int `json:"errors,omitempty"` // Number of failed requests by status code, or "request error"
+}
+
+func (s *LoadTestSummary) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Requests)
+}
+
+func summarise(results []PredictionResult, elapsed time.Duration) *LoadTestSummary {
+	summary := &LoadTestSummary{
+		Requests: len(results),
+		Elapsed:  Duration(elapsed),
+		Errors:   map[string]int{},
+	}
+	var latencies []time.Duration
+	for _, result := range results {
+		switch {
+		case !result.Failed():
+			latencies = append(latencies, time.Duration(result.Latency))
+		case result.StatusCode != 0:
+			summary.Failed++
+			summary.Errors[fmt.Sprintf("%d %s", result.StatusCode, http.StatusText(result.StatusCode))]++
+		default:
+			summary.Failed++
+			summary.Errors["request error"]++
+		}
+	}
+	if elapsed > 0 {
+		summary.Throughput = float64(len(results)) / elapsed.Seconds()
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	summary.P50 = percentile(latencies, 0.5)
+	summary.P90 = percentile(latencies, 0.9)
+	summary.P99 = percentile(latencies, 0.99)
+	return summary
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies, or 0 if there are none
+func percentile(sorted []time.Duration, p float64) Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return Duration(sorted[rank-1])
+}
+
+// LoadTest sends the request payloads of a JSON Lines file to the prediction endpoint of the deployed model over and
+// over for Duration, and fails if the latency, throughput or error rate do not meet the SLOs that are given. Requests
+// are only sent to the REST API, so deployments served over gRPC, see predict.UsesGRPC, cannot be load tested yet.
+// Duration is part of the timeout of the run, which has to leave time for it
+type LoadTest struct {
+	RequestsFile string   // JSON Lines file with a request payload on every line
+	BaseURL      string   // Base URL of the model's REST API, see Predict
+	IngressURL   string   // URL of the Seldon ingress, see Predict
+	Duration     Duration // How long requests are sent for
+	RPS          float64  // Target number of requests per second, as many as the workers can send if not given
+	Concurrency  int      // Number of workers sending requests at the same time, 1 if not given
+
+	// SLOs, which are not checked if not given
+	MaxP50        Duration
+	MaxP90        Duration
+	MaxP99        Duration
+	MinThroughput float64 // Requests per second
+	MaxErrorRate  float64 // Highest fraction of requests that may fail, between 0 and 1. Checked even if not given
+
+	Summary *LoadTestSummary `json:"-"` // Summary of the requests sent by the last Do
+}
+
+func (l *LoadTest) Eventless() {}
+
+func (l *LoadTest) Do(ctx context.Context, d *Deployer) error {
+	logger := d.logFor(l)
+	if l.Duration <= 0 {
+		return WithKind(ErrValidation, fmt.Errorf("load test needs a duration"))
+	}
+	if predict.UsesGRPC(d.deployment) {
+		return WithKind(ErrValidation, fmt.Errorf("load test only sends requests to the REST API, but the deployment is served over gRPC"))
+	}
+	url, _, err := predictionsURL(d, l.BaseURL, l.IngressURL)
+	if err != nil {
+		return err
+	}
+	payloads, err := readPayloadsFile(l.RequestsFile)
+	if err != nil {
+		return err
+	}
+	if d.dryRun {
+		logger.Infof("Not load testing %s in a dry run", url)
+		return nil
+	}
+
+	logger.Info(ActionLog("Load testing %s for %s...", url, time.Duration(l.Duration)))
+	start := time.Now()
+	results := l.run(ctx, d.httpClient, url, payloads)
+	l.Summary = summarise(results, time.Since(start))
+	logger.WithFields(log.Fields{
+		"requests":   l.Summary.Requests,
+		"error_rate": l.Summary.ErrorRate(),
+		"throughput": l.Summary.Throughput,
+		"p50":        time.Duration(l.Summary.P50),
+		"p90":        time.Duration(l.Summary.P90),
+		"p99":        time.Duration(l.Summary.P99),
+	}).Info("Load test has finished")
+	return errors.Wrap(ctx.Err(), "load test was cut short")
+}
+
+// run sends requests with l.Concurrency workers, at most l.RPS a second, until l.Duration has passed or ctx is done
+func (l *LoadTest) run(ctx context.Context, client *http.Client, url string, payloads []Payload) []PredictionResult {
+	stop := make(chan struct{})
+	timer := time.AfterFunc(time.Duration(l.Duration), func() { close(stop) })
+	defer timer.Stop()
+	var ticks <-chan time.Time
+	if l.RPS > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / l.RPS))
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	concurrency := l.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []PredictionResult
+		sent    int64
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if ticks != nil {
+					// Wait for the next tick, so that the target rate is not exceeded
+					select {
+					case <-ticks:
+					case <-stop:
+						return
+					case <-ctx.Done():
+						return
+					}
+				}
+				select {
+				case <-stop:
+					return
+				case <-ctx.Done():
+					return
+				default:
+				}
+				payload := payloads[int(atomic.AddInt64(&sent, 1)-1)%len(payloads)]
+				result := sendPrediction(ctx, client, url, payload)
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (l *LoadTest) Done(event Event) (bool, error) {
+	if l.Summary == nil {
+		return false, fmt.Errorf("load test has not been run")
+	}
+	var violations []string
+	if rate := l.Summary.ErrorRate(); rate > l.MaxErrorRate {
+		violations = append(violations, fmt.Sprintf("error rate %.1f%% is above %.1f%%", rate*100, l.MaxErrorRate*100))
+	}
+	latencies := []struct {
+		name       string
+		value, max Duration
+	}{
+		{"p50", l.Summary.P50, l.MaxP50},
+		{"p90", l.Summary.P90, l.MaxP90},
+		{"p99", l.Summary.P99, l.MaxP99},
+	}
+	for _, latency := range latencies {
+		if latency.max > 0 && latency.value > latency.max {
+			violations = append(violations, fmt.Sprintf("%s latency %s is above %s",
+				latency.name, time.Duration(latency.value), time.Duration(latency.max)))
+		}
+	}
+	if l.MinThroughput > 0 && l.Summary.Throughput < l.MinThroughput {
+		violations = append(violations, fmt.Sprintf("throughput %.1f/s is below %.1f/s", l.Summary.Throughput, l.MinThroughput))
+	}
+	if len(violations) > 0 {
+		return false, fmt.Errorf("load test violated its SLOs: %s", strings.Join(violations, ", "))
+	}
+	return true, nil
+}
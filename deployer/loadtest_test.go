@@ -0,0 +1,91 @@
+package deployer
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSummarise(t *testing.T) {
+	var results []PredictionResult
+	for i := 1; i <= 100; i++ {
+		results = append(results, PredictionResult{StatusCode: http.StatusOK, Latency: Duration(time.Duration(i) * time.Millisecond)})
+	}
+	results = append(results,
+		PredictionResult{StatusCode: http.StatusInternalServerError, Error: "failed"},
+		PredictionResult{StatusCode: http.StatusInternalServerError, Error: "failed"},
+		PredictionResult{Error: "connection refused"},
+	)
+
+	summary := summarise(results, 2*time.Second)
+	assert.Equal(t, 103, summary.Requests)
+	assert.Equal(t, 3, summary.Failed)
+	assert.Equal(t, 51.5, summary.Throughput)
+	assert.Equal(t, Duration(50*time.Millisecond), summary.P50)
+	assert.Equal(t, Duration(90*time.Millisecond), summary.P90)
+	assert.Equal(t, Duration(99*time.Millisecond), summary.P99)
+	assert.Equal(t, map[string]int{"500 Internal Server Error": 2, "request error": 1}, summary.Errors)
+}
+
+func TestDeployer_RunInstructions_LoadTest(t *testing.T) {
+	t.Run("sends requests at the target rate", func(t *testing.T) {
+		server := newModelServer(t)
+		deployer, _ := newTestDeployer(t, nil, WithHTTPClient(server.Client()))
+		loadTest := &LoadTest{
+			RequestsFile: writeRequestsFile(t, `{"data":{"ndarray":[[1]]}}`, `{"data":{"ndarray":[[2]]}}`),
+			BaseURL:      server.URL,
+			Duration:     Duration(500 * time.Millisecond),
+			RPS:          40,
+			Concurrency:  4,
+			MaxP99:       Duration(time.Second),
+		}
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{loadTest}))
+		require.NotNil(t, loadTest.Summary)
+		assert.InDelta(t, 20, loadTest.Summary.Requests, 5)
+		assert.Equal(t, 0, loadTest.Summary.Failed)
+		assert.True(t, loadTest.Summary.P50 > 0)
+	})
+
+	t.Run("violated SLOs fail the plan", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(20 * time.Millisecond)
+			http.Error(w, `{}`, http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		deployer, _ := newTestDeployer(t, nil)
+		loadTest := &LoadTest{
+			RequestsFile:  writeRequestsFile(t, `{"data":{}}`),
+			BaseURL:       server.URL,
+			Duration:      Duration(200 * time.Millisecond),
+			MinThroughput: 1000,
+		}
+
+		err := deployer.RunInstructions([]DeploymentInstruction{loadTest})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "error rate 100.0% is above 0.0%")
+		assert.Contains(t, err.Error(), "throughput")
+		assert.Equal(t, loadTest.Summary.Requests, loadTest.Summary.Errors["503 Service Unavailable"])
+	})
+
+	t.Run("deployments served over gRPC are not load tested over REST", func(t *testing.T) {
+		server := newModelServer(t)
+		deployer, _ := newTestDeployer(t, nil, WithHTTPClient(server.Client()))
+		deployer.deployment.Spec.Transport = "grpc"
+		loadTest := &LoadTest{
+			RequestsFile: writeRequestsFile(t, `{"data":{"ndarray":[[1]]}}`),
+			BaseURL:      server.URL,
+			Duration:     Duration(200 * time.Millisecond),
+		}
+
+		err := deployer.RunInstructions([]DeploymentInstruction{loadTest})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrValidation))
+		assert.Contains(t, err.Error(), "served over gRPC")
+		assert.Nil(t, loadTest.Summary)
+	})
+}
@@ -0,0 +1,85 @@
+package deployer
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+)
+
+type LogFormat string
+
+const (
+	TextLogFormat LogFormat = "text"
+	JSONLogFormat LogFormat = "json"
+)
+
+// Named loggers for the Deployer and the Observer, so that each can be configured independently
+var (
+	DeployerLogger = log.New()
+	ObserverLogger = log.New()
+)
+
+// Keys of the structured fields attached to log entries
+const (
+	ComponentField       = "component"
+	DeploymentField      = "deployment"
+	NamespaceField       = "namespace"
+	InstructionField     = "instruction"
+	EventTypeField       = "event_type"
+	StateField           = "state"
+	ResourceVersionField = "resource_version"
+)
+
+// ConfigureLogger sets the format and level of a logger. Colours are only used for text logs written to a terminal.
+func ConfigureLogger(logger *log.Logger, format LogFormat, level log.Level) error {
+	switch format {
+	case TextLogFormat, "":
+		logger.SetFormatter(&log.TextFormatter{
+			DisableColors: !ColourEnabled(),
+			FullTimestamp: true,
+		})
+	case JSONLogFormat:
+		logger.SetFormatter(&log.JSONFormatter{})
+	default:
+		return WithKind(ErrValidation, fmt.Errorf("unknown log format '%s'", format))
+	}
+	logger.SetLevel(level)
+	return nil
+}
+
+// ConfigureColour enables colours only if the log output is a terminal, and NO_COLOR is not set
+// (see https://no-color.org). Colours are always disabled for JSON logs.
+func ConfigureColour(format LogFormat, out io.Writer) {
+	_, noColour := os.LookupEnv("NO_COLOR")
+	SetColourEnabled(format != JSONLogFormat && !noColour && isTerminal(out))
+}
+
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func deploymentFields(namespace, name string) log.Fields {
+	return log.Fields{
+		DeploymentField: name,
+		NamespaceField:  namespace,
+	}
+}
+
+func eventFields(event Event) log.Fields {
+	fields := log.Fields{EventTypeField: event.Type}
+	if event.Deployment != nil {
+		fields[DeploymentField] = event.Deployment.GetName()
+		fields[NamespaceField] = event.Deployment.GetNamespace()
+		fields[StateField] = event.Deployment.Status.State
+	}
+	return fields
+}
@@ -0,0 +1,48 @@
+package deployer
+
+import (
+	"bytes"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestConfigureColour(t *testing.T) {
+	defer SetColourEnabled(true)
+
+	ConfigureColour(TextLogFormat, &bytes.Buffer{})
+	assert.False(t, ColourEnabled(), "colours should be disabled when not writing to a terminal")
+	assert.Equal(t, "Scaling replicas to 2...", ActionLog("Scaling replicas to %d...", 2))
+
+	SetColourEnabled(true)
+	assert.Equal(t, "\033[1;32mScaling replicas to 2...\033[0m", ActionLog("Scaling replicas to %d...", 2))
+
+	require.NoError(t, os.Setenv("NO_COLOR", ""))
+	defer os.Unsetenv("NO_COLOR")
+	ConfigureColour(TextLogFormat, os.Stdout)
+	assert.False(t, ColourEnabled(), "colours should be disabled when NO_COLOR is set")
+}
+
+func TestConfigureLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&buf)
+	require.NoError(t, ConfigureLogger(logger, JSONLogFormat, log.WarnLevel))
+
+	entry := logger.WithField(ComponentField, "deployer").WithFields(deploymentFields("seldon", "example"))
+	entry.Info("not logged")
+	entry.WithField(InstructionField, "Create").Warn("logged")
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "logged", decoded["msg"])
+	assert.Equal(t, "deployer", decoded[ComponentField])
+	assert.Equal(t, "example", decoded[DeploymentField])
+	assert.Equal(t, "seldon", decoded[NamespaceField])
+	assert.Equal(t, "Create", decoded[InstructionField])
+
+	assert.Error(t, ConfigureLogger(logger, "xml", log.InfoLevel))
+}
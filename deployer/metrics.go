@@ -0,0 +1,122 @@
+package deployer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+// MetricsNamespace prefixes the names of all metrics
+const MetricsNamespace = "seldon_deployer"
+
+// Phases of an instruction whose durations are measured separately
+const (
+	PhaseDo   = "do"
+	PhaseDone = "done"
+)
+
+// Metrics are the Prometheus metrics of Deployers, Observers and Controllers. They are registered on a registry of
+// their own instead of the global one, so that applications embedding the package opt in by serving Handler or by
+// gathering Registry themselves. A nil *Metrics records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	instructions         *prometheus.CounterVec   // By instruction and outcome
+	instructionDurations *prometheus.HistogramVec // By instruction and phase
+	events               *prometheus.CounterVec   // By event type
+	timeToAvailable      prometheus.Histogram
+	scaleConflicts       prometheus.Counter
+	resyncs              prometheus.Counter
+}
+
+// NewMetrics creates the metrics on a new registry
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		instructions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "instructions_total",
+			Help:      "Number of instructions executed, by instruction type and outcome.",
+		}, []string{"instruction", "outcome"}),
+		instructionDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "instruction_duration_seconds",
+			Help:      "Time it took to carry out instructions (do) and to wait until they were done (done).",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+		}, []string{"instruction", "phase"}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "observed_events_total",
+			Help:      "Number of SeldonDeployment events observed, by event type.",
+		}, []string{"type"}),
+		timeToAvailable: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: MetricsNamespace,
+			Name:      "time_to_available_seconds",
+			Help:      "Time from creating a SeldonDeployment until it was Available.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		}),
+		scaleConflicts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "scale_conflict_retries_total",
+			Help:      "Number of times scaling replicas was retried because the SeldonDeployment had been modified.",
+		}),
+		resyncs: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: MetricsNamespace,
+			Name:      "informer_resyncs_total",
+			Help:      "Number of unchanged SeldonDeployments redelivered by informer resyncs.",
+		}),
+	}
+	m.registry.MustRegister(m.instructions, m.instructionDurations, m.events, m.timeToAvailable, m.scaleConflicts, m.resyncs)
+	return m
+}
+
+// Registry returns the registry the metrics are registered on
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler returns an HTTP handler that serves the metrics in the Prometheus exposition format, e.g. at /metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) instructionExecuted(instruction string, report *InstructionReport) {
+	if m == nil {
+		return
+	}
+	m.instructions.WithLabelValues(instruction, string(report.Status)).Inc()
+	m.instructionDurations.WithLabelValues(instruction, PhaseDo).Observe(time.Duration(report.DoDuration).Seconds())
+	if report.DoneDuration > report.DoDuration {
+		done := time.Duration(report.DoneDuration - report.DoDuration)
+		m.instructionDurations.WithLabelValues(instruction, PhaseDone).Observe(done.Seconds())
+	}
+}
+
+func (m *Metrics) eventObserved(eventType EventType) {
+	if m == nil {
+		return
+	}
+	m.events.WithLabelValues(string(eventType)).Inc()
+}
+
+func (m *Metrics) becameAvailable(sinceCreate time.Duration) {
+	if m == nil {
+		return
+	}
+	m.timeToAvailable.Observe(sinceCreate.Seconds())
+}
+
+func (m *Metrics) scaleConflict() {
+	if m == nil {
+		return
+	}
+	m.scaleConflicts.Inc()
+}
+
+func (m *Metrics) resynced() {
+	if m == nil {
+		return
+	}
+	m.resyncs.Inc()
+}
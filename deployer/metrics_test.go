@@ -0,0 +1,57 @@
+package deployer
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	deployer, clientset := newTestDeployer(t, nil, WithMetrics(metrics))
+	conflicts := 0
+	clientset.PrependReactor("update", "seldondeployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		replicas := action.(k8stesting.UpdateAction).GetObject().(*machinelearningv1.SeldonDeployment).Spec.Replicas
+		if replicas != nil && conflicts == 0 {
+			conflicts++
+			return true, nil, k8serrors.NewConflict(seldonDeploymentsResource, "seldon-deployment-example", fmt.Errorf("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}, &ScaleReplicas{NumReplicas: 3}, &Delete{}}))
+
+	for _, instruction := range []string{"Create", "ScaleReplicas", "Delete"} {
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.instructions.WithLabelValues(instruction, string(InstructionPassed))), instruction)
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.scaleConflicts))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.events.WithLabelValues(string(Added))))
+	assert.True(t, testutil.ToFloat64(metrics.events.WithLabelValues(string(Updated))) > 0)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.events.WithLabelValues(string(Deleted))))
+
+	deployment := newTestDeployment()
+	deployment.ResourceVersion = "1"
+	deployer.observer.(*ObserverV2).update(deployment, deployment.DeepCopy())
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.resyncs))
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `seldon_deployer_instructions_total{instruction="Create",outcome="passed"} 1`)
+	assert.Contains(t, string(body), `seldon_deployer_instruction_duration_seconds_count{instruction="Create",phase="done"} 1`)
+	assert.Contains(t, string(body), "seldon_deployer_time_to_available_seconds_count 1")
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	deployer, _ := newTestDeployer(t, nil)
+	assert.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}, &Delete{}}))
+}
@@ -8,9 +8,18 @@ import (
 	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
 	seldonclientset "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned"
 	seldonfactory "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/informers/externalversions"
+	seldonlisters "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/listers/machinelearning.seldon.io/v1"
 	"github.com/sergi/go-diff/diffmatchpatch"
 	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,10 +36,36 @@ const (
 type Event struct {
 	Deployment *machinelearningv1.SeldonDeployment
 	Type       EventType
+	Time       time.Time // When the event was observed
+}
+
+// Observer is a source of events for the Deployer. Run is called in a go routine, and should pass every event to the
+// function set with SetNotifyFunc.
+type Observer interface {
+	SetNotifyFunc(func(Event) error)
+	Run()
+}
+
+// CachedObserver is implemented by Observers that keep a cache of the SeldonDeployments they observe, like ObserverV2.
+// Before running any instruction, the Deployer waits for the cache to sync and takes a snapshot of its deployment from
+// it, so that the events of the initial list are not mistaken for effects of the instructions.
+type CachedObserver interface {
+	Observer
+	WaitForCacheSync(ctx context.Context) error
+	// Cached returns the cached SeldonDeployment, or nil if it does not exist
+	Cached(namespace, name string) (*machinelearningv1.SeldonDeployment, error)
+}
+
+// StoppableObserver is implemented by Observers that can be stopped, like ObserverV2 and ReplayObserver. Run returns
+// once Stop has been called, and Close of the Deployer waits for it.
+type StoppableObserver interface {
+	Observer
+	Stop()
 }
 
 type ObserverV2 struct { // TODO: Rename this to Observer. Weird IDE bug
 	factory          seldonfactory.SharedInformerFactory
+	kubeFactory      informers.SharedInformerFactory // Only set if Kubernetes events are watched
 	NotifyFunc       func(Event) error
 	ErrorFunc        func()
 	stopInformerChan chan struct{}
@@ -40,10 +75,21 @@ type ObserverV2 struct { // TODO: Rename this to Observer. Weird IDE bug
 	lastDeploy       machinelearningv1.SeldonDeployment
 	stopContext      context.Context
 	cancelFunc       func()
+	log              log.FieldLogger
+	recording        *EventWriter // Only set if events are recorded
+	metrics          *Metrics
+	loopErr          atomic.Value // Error the notify loop exited with, if it exited before the observer was stopped
+}
+
+// NewObserver creates an Observer of the SeldonDeployments of clientset. If kubeClient is not nil, the Kubernetes
+// events of SeldonDeployments are logged as well. It logs to ObserverLogger unless another logger is injected with
+// WithObserverLogger.
+func NewObserver(clientset seldonclientset.Interface, kubeClient kubernetes.Interface, opts ...Option) *ObserverV2 {
+	return newObserver(clientset, kubeClient, newOptions(opts))
 }
 
-func NewObserver(clientset *seldonclientset.Clientset) *ObserverV2 {
-	informerFactory := seldonfactory.NewSharedInformerFactory(clientset, 10*time.Second)
+func newObserver(clientset seldonclientset.Interface, kubeClient kubernetes.Interface, options *options) *ObserverV2 {
+	informerFactory := seldonfactory.NewSharedInformerFactory(clientset, options.resync)
 	deploymentInformer := informerFactory.Machinelearning().V1().SeldonDeployments().Informer()
 	stopContext, cancelFunc := context.WithCancel(context.Background())
 	observer := &ObserverV2{
@@ -55,6 +101,11 @@ func NewObserver(clientset *seldonclientset.Clientset) *ObserverV2 {
 		lastDeploy:       machinelearningv1.SeldonDeployment{},
 		stopContext:      stopContext,
 		cancelFunc:       cancelFunc,
+		log:              options.observerLogger().WithField(ComponentField, "observer"),
+		metrics:          options.metrics,
+	}
+	if options.recording != nil {
+		observer.recording = NewEventWriter(options.recording)
 	}
 
 	deploymentInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -63,26 +114,124 @@ func NewObserver(clientset *seldonclientset.Clientset) *ObserverV2 {
 		UpdateFunc: observer.update,
 	})
 
+	if kubeClient != nil {
+		observer.kubeFactory = informers.NewSharedInformerFactoryWithOptions(kubeClient, options.resync,
+			informers.WithTweakListOptions(func(listOptions *metav1.ListOptions) {
+				listOptions.FieldSelector = fields.OneTermEqualSelector("involvedObject.kind", "SeldonDeployment").String()
+			}))
+		observer.kubeFactory.Core().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    observer.logKubernetesEvent,
+			UpdateFunc: func(_, newObj interface{}) { observer.logKubernetesEvent(newObj) },
+		})
+	}
+
+	options.health.AddReadinessCheck("informer-synced", observer.synced)
+	options.health.AddLivenessCheck("notify-loop", observer.notifyLoopHealthy)
 	return observer
 }
 
 func (o *ObserverV2) WaitTillContextIsCancelled(ctx context.Context) {
 	select {
 	case <-ctx.Done():
-		log.Info(EventLog("Context has been cancelled successfully"))
+		o.log.Info(EventLog("Context has been cancelled successfully"))
 	}
+	o.Stop()
+}
+
+// Stop stops the informers and makes Run return. It is safe to call more than once.
+func (o *ObserverV2) Stop() {
 	o.cancelFunc()
 }
 
-// Main event loop. To be called in a go routine
+// informers returns the informers of the observer's factories
+func (o *ObserverV2) informers() []cache.SharedIndexInformer {
+	informers := []cache.SharedIndexInformer{o.factory.Machinelearning().V1().SeldonDeployments().Informer()}
+	if o.kubeFactory != nil {
+		informers = append(informers, o.kubeFactory.Core().V1().Events().Informer())
+	}
+	return informers
+}
+
+// lister returns the lister of the SeldonDeployments cached by the observer's informer
+func (o *ObserverV2) lister() seldonlisters.SeldonDeploymentLister {
+	return o.factory.Machinelearning().V1().SeldonDeployments().Lister()
+}
+
+// hasSynced returns whether the observer's informer has listed all SeldonDeployments since it was started
+func (o *ObserverV2) hasSynced() bool {
+	return o.factory.Machinelearning().V1().SeldonDeployments().Informer().HasSynced()
+}
+
+// WaitForCacheSync blocks until the observer's informers have listed all SeldonDeployments and Kubernetes events. It
+// returns an error if ctx is done first.
+func (o *ObserverV2) WaitForCacheSync(ctx context.Context) error {
+	var synced []cache.InformerSynced
+	for _, informer := range o.informers() {
+		synced = append(synced, informer.HasSynced)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return errors.Wrap(ctx.Err(), "informer caches did not sync")
+	}
+	return nil
+}
+
+// Cached returns the SeldonDeployment as cached by the observer's informer, or nil if it does not exist
+func (o *ObserverV2) Cached(namespace, name string) (*machinelearningv1.SeldonDeployment, error) {
+	deploy, err := o.lister().SeldonDeployments(namespace).Get(name)
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return deploy.DeepCopy(), nil
+}
+
+// synced returns an error until the observer's informers have listed all SeldonDeployments and Kubernetes events
+func (o *ObserverV2) synced() error {
+	if !o.hasSynced() {
+		return fmt.Errorf("SeldonDeployment informer has not synced")
+	}
+	if o.kubeFactory != nil && !o.kubeFactory.Core().V1().Events().Informer().HasSynced() {
+		return fmt.Errorf("Kubernetes event informer has not synced")
+	}
+	return nil
+}
+
+// notifyLoopHealthy returns an error if the notify loop has exited with an error
+func (o *ObserverV2) notifyLoopHealthy() error {
+	if err, exited := o.loopErr.Load().(error); exited {
+		return errors.Wrap(err, "notify loop exited")
+	}
+	return nil
+}
+
+func (o *ObserverV2) SetNotifyFunc(notifyFunc func(Event) error) {
+	o.NotifyFunc = notifyFunc
+}
+
+// Main event loop. To be called in a go routine. Run returns once the observer has been stopped, or the notify loop has
+// failed, and its informers have stopped.
 func (o *ObserverV2) Run() {
-	defer close(o.stopInformerChan) // TODO: According to documentation, the informer is stopped when the stopchan is closed. Verify this.
-	o.factory.Start(o.stopInformerChan)
+	// The informers are run here rather than by their factories, which do not wait for them to stop
+	var informers sync.WaitGroup
+	defer informers.Wait()
+	defer close(o.stopInformerChan)
+	for _, informer := range o.informers() {
+		informers.Add(1)
+		go func(informer cache.SharedIndexInformer) {
+			defer informers.Done()
+			informer.Run(o.stopInformerChan)
+		}(informer)
+	}
 	err := o.notifyLoop()
 	if err != nil {
-		log.Error(errors.Wrap(err, "exited notify loop"))
+		if o.stopContext.Err() == nil {
+			o.loopErr.Store(err)
+		}
+		o.log.WithError(err).Error("exited notify loop")
 		if o.ErrorFunc != nil {
-			log.Info("calling notify error handler function...")
+			o.log.Info("calling notify error handler function...")
 			o.ErrorFunc()
 		}
 	}
@@ -90,25 +239,30 @@ func (o *ObserverV2) Run() {
 
 // This is our main event loop.
 // The notifyChan is constantly read.
-func (o ObserverV2) notifyLoop() error {
+func (o *ObserverV2) notifyLoop() error {
 	for {
 		select {
 		case event := <-o.notifyChan:
 			o.printDiffFromLastEvent(event.Deployment)
-			err := o.NotifyFunc(event)
-			if err != nil {
+			if o.recording != nil {
+				if err := o.recording.Write(event); err != nil {
+					o.log.WithError(err).Error("could not record event")
+				}
+			}
+			if err := o.NotifyFunc(event); err != nil {
 				return errors.Wrapf(err, "NotifyFunc of %s event failed. Exiting notify loop", event.Type)
 			}
 		case <-o.stopContext.Done():
-			log.Errorf("context cancelled for notify loop")
-			return fmt.Errorf("context cancelled for notify loop")
+			o.log.Info(EventLog("Observer has been stopped"))
+			return nil
 		}
 	}
 }
 
 func (o *ObserverV2) sendToNotifyLoop(event Event) {
 	// TODO: Figure out what's the best way to log kubernetes events?
-	log.Infof(DescriptionLog("[KUBERNETES EVENT] [Deployment %s] %v", event.Type, event.Deployment.Status.State))
+	o.log.WithFields(eventFields(event)).Info(DescriptionLog("Kubernetes event"))
+	o.metrics.eventObserved(event.Type)
 	select {
 	case o.notifyChan <- event:
 	case <-o.stopContext.Done():
@@ -117,12 +271,20 @@ func (o *ObserverV2) sendToNotifyLoop(event Event) {
 
 func (o *ObserverV2) add(obj interface{}) {
 	deploy := obj.(*machinelearningv1.SeldonDeployment)
-	o.sendToNotifyLoop(Event{deploy, Added})
+	o.sendToNotifyLoop(Event{deploy, Added, time.Now()})
 }
 
 func (o *ObserverV2) delete(obj interface{}) {
-	deploy := obj.(*machinelearningv1.SeldonDeployment)
-	o.sendToNotifyLoop(Event{deploy, Deleted})
+	// The final state of a deployment that was deleted while the watch was disconnected may be unknown
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	deploy, ok := obj.(*machinelearningv1.SeldonDeployment)
+	if !ok {
+		o.log.Errorf("could not get the deleted deployment from a %T", obj)
+		return
+	}
+	o.sendToNotifyLoop(Event{deploy, Deleted, time.Now()})
 }
 
 func (o *ObserverV2) update(oldObj, newObj interface{}) {
@@ -130,15 +292,39 @@ func (o *ObserverV2) update(oldObj, newObj interface{}) {
 	oldDeploy := oldObj.(*machinelearningv1.SeldonDeployment)
 	if newDeploy.ResourceVersion == oldDeploy.ResourceVersion {
 		// only update when new is different from old.
-		log.Info("Resource version is the same")
+		o.log.WithFields(eventFields(Event{Deployment: newDeploy, Type: Updated})).Debug("Resource version is the same")
+		o.metrics.resynced()
 		return
 	}
-	o.sendToNotifyLoop(Event{newDeploy, Updated})
+	o.sendToNotifyLoop(Event{newDeploy, Updated, time.Now()})
+}
+
+// logKubernetesEvent logs the events that kubectl describe would show for a SeldonDeployment
+func (o *ObserverV2) logKubernetesEvent(obj interface{}) {
+	event, ok := obj.(*v1.Event)
+	if !ok {
+		return
+	}
+	logger := o.log.WithFields(log.Fields{
+		DeploymentField: event.InvolvedObject.Name,
+		NamespaceField:  event.InvolvedObject.Namespace,
+		"reason":        event.Reason,
+		"count":         event.Count,
+	})
+	if event.Type == v1.EventTypeWarning {
+		logger.Warn(DescriptionLog(event.Message))
+		return
+	}
+	logger.Info(DescriptionLog(event.Message))
 }
 
 func (o *ObserverV2) printDiffFromLastEvent(newDeploy *machinelearningv1.SeldonDeployment) {
 	diffs := o.diffMatchParam.DiffMain(prettyPrint(o.lastDeploy), prettyPrint(newDeploy), false)
-	log.Debug(o.diffMatchParam.DiffPrettyText(diffs))
+	diffText := o.diffMatchParam.PatchToText(o.diffMatchParam.PatchMake(diffs))
+	if ColourEnabled() {
+		diffText = o.diffMatchParam.DiffPrettyText(diffs)
+	}
+	o.log.WithField(DeploymentField, newDeploy.GetName()).Debug(diffText)
 	o.lastDeploy = *newDeploy
 
 }
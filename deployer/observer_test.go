@@ -0,0 +1,37 @@
+package deployer
+
+import (
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-client-k8s/deployertest"
+	"k8s.io/client-go/tools/cache"
+	"testing"
+)
+
+func TestObserverV2_delete(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	observer := NewObserver(deployertest.NewClientset(), nil, WithObserverLogger(logger))
+	deploy := newTestDeployment()
+
+	t.Run("deployment", func(t *testing.T) {
+		go observer.delete(deploy)
+		event := <-observer.notifyChan
+		assert.Equal(t, Deleted, event.Type)
+		assert.Equal(t, deploy, event.Deployment)
+	})
+
+	t.Run("deployment with an unknown final state", func(t *testing.T) {
+		go observer.delete(cache.DeletedFinalStateUnknown{Key: "seldon/seldon-deployment-example", Obj: deploy})
+		event := <-observer.notifyChan
+		assert.Equal(t, Deleted, event.Type)
+		assert.Equal(t, deploy, event.Deployment)
+	})
+
+	t.Run("something else", func(t *testing.T) {
+		hook.Reset()
+		observer.delete(cache.DeletedFinalStateUnknown{Key: "seldon/other"})
+		require.NotNil(t, hook.LastEntry())
+		assert.Contains(t, hook.LastEntry().Message, "could not get the deleted deployment")
+	})
+}
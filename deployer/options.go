@@ -0,0 +1,198 @@
+package deployer
+
+import (
+	seldondeployment "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned/typed/machinelearning.seldon.io/v1"
+	log "github.com/sirupsen/logrus"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	"google.golang.org/grpc"
+	"io"
+	"k8s.io/client-go/tools/record"
+	"net/http"
+	"time"
+)
+
+// Defaults used when the corresponding options are not given
+const (
+	DefaultTimeout = 60 * time.Second
+	DefaultResync  = 10 * time.Second
+
+	DefaultRequestTimeout = 30 * time.Second
+	DefaultWorkers        = 1
+)
+
+// Option configures a Deployer or an Observer
+type Option func(*options)
+
+type options struct {
+	deployerLog   log.FieldLogger
+	observerLog   log.FieldLogger
+	timeout       time.Duration
+	resync        time.Duration
+	namespace     string
+	observer      Observer
+	recording     io.Writer
+	client        seldondeployment.SeldonDeploymentInterface
+	dryRun        bool
+	eventRecorder record.EventRecorder
+	httpClient    *http.Client
+	portForwarder PortForwarder
+	grpcDialOpts  []grpc.DialOption
+	workers       int
+	metrics       *Metrics
+	tracing       apitrace.TracerProvider
+	health        *Health
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		timeout: DefaultTimeout,
+		resync:  DefaultResync,
+		workers: DefaultWorkers,
+		httpClient: &http.Client{
+			Timeout: DefaultRequestTimeout,
+		},
+		grpcDialOpts: []grpc.DialOption{grpc.WithInsecure()},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithLogger makes the Deployer log to logger instead of DeployerLogger
+func WithLogger(logger log.FieldLogger) Option {
+	return func(o *options) {
+		o.deployerLog = logger
+	}
+}
+
+// WithObserverLogger makes the Observer log to logger instead of ObserverLogger
+func WithObserverLogger(logger log.FieldLogger) Option {
+	return func(o *options) {
+		o.observerLog = logger
+	}
+}
+
+// WithTimeout sets how long a single RunInstructions call may take. It has to be positive.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithResync sets the resync period of the Observer's informers
+func WithResync(resync time.Duration) Option {
+	return func(o *options) {
+		o.resync = resync
+	}
+}
+
+// WithNamespace deploys into namespace, instead of the namespace of the deployment's metadata
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithObserver makes the Deployer consume the events of observer, e.g. a ReplayObserver, instead of creating its own
+// Observer
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		o.observer = observer
+	}
+}
+
+// WithRecording makes the Observer record every event it passes on to w as JSON Lines, which a ReplayObserver can
+// replay later on
+func WithRecording(w io.Writer) Option {
+	return func(o *options) {
+		o.recording = w
+	}
+}
+
+// WithClient makes the Deployer carry out instructions with client, instead of a client created from the rest config
+func WithClient(client seldondeployment.SeldonDeploymentInterface) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithDryRun sends every request as a server-side dry run, so that nothing is persisted in the cluster.
+// As a dry run does not produce any events, instructions are not waited on.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// WithEventRecorder records the progress of every instruction as Kubernetes events on the SeldonDeployment
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(o *options) {
+		o.eventRecorder = recorder
+	}
+}
+
+// WithHTTPClient makes instructions send requests to the served model with client
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithPortForwarder makes PortForward instructions open port-forwards with forwarder. NewDeployer uses a
+// SPDYPortForwarder for its config by default.
+func WithPortForwarder(forwarder PortForwarder) Option {
+	return func(o *options) {
+		o.portForwarder = forwarder
+	}
+}
+
+// WithGRPCDialOptions makes instructions dial the gRPC API of the served model with opts, e.g. to use TLS, instead of
+// an insecure connection
+func WithGRPCDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.grpcDialOpts = opts
+	}
+}
+
+// WithWorkers sets how many SeldonDeployments a Controller reconciles at the same time
+func WithWorkers(workers int) Option {
+	return func(o *options) {
+		o.workers = workers
+	}
+}
+
+// WithMetrics records the Prometheus metrics of the Deployer, its Observer or a Controller in metrics
+func WithMetrics(metrics *Metrics) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithTracerProvider starts the spans of the Deployer with a tracer of provider instead of the global tracer provider
+func WithTracerProvider(provider apitrace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracing = provider
+	}
+}
+
+// WithHealth adds the liveness and readiness checks of the Observer to health
+func WithHealth(health *Health) Option {
+	return func(o *options) {
+		o.health = health
+	}
+}
+
+func (o *options) deployerLogger() log.FieldLogger {
+	if o.deployerLog == nil {
+		return DeployerLogger
+	}
+	return o.deployerLog
+}
+
+func (o *options) observerLogger() log.FieldLogger {
+	if o.observerLog == nil {
+		return ObserverLogger
+	}
+	return o.observerLog
+}
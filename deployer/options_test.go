@@ -0,0 +1,85 @@
+package deployer
+
+import (
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	seldonclientset "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"testing"
+	"time"
+)
+
+func newTestDeployment() *machinelearningv1.SeldonDeployment {
+	return &machinelearningv1.SeldonDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "seldon-deployment-example", Namespace: "seldon"},
+	}
+}
+
+func TestNewDeployer_Logging(t *testing.T) {
+	config := &rest.Config{Host: "http://localhost"}
+
+	t.Run("injected loggers", func(t *testing.T) {
+		deployerLogger, deployerHook := test.NewNullLogger()
+		observerLogger, _ := test.NewNullLogger()
+		deployer, err := NewDeployer(config, newTestDeployment(),
+			WithLogger(deployerLogger), WithObserverLogger(observerLogger))
+		require.NoError(t, err)
+
+		require.NotNil(t, deployerHook.LastEntry())
+		assert.Equal(t, "New deployment created...", deployerHook.LastEntry().Message)
+		assert.Equal(t, "deployer", deployerHook.LastEntry().Data[ComponentField])
+		assert.Equal(t, "seldon-deployment-example", deployerHook.LastEntry().Data[DeploymentField])
+
+		deployer.observer.(*ObserverV2).log.Info("observed")
+		assert.Equal(t, "deployer", deployerHook.LastEntry().Data[ComponentField], "observer should not log to the deployer logger")
+	})
+}
+
+func TestNewDeployer_Options(t *testing.T) {
+	config := &rest.Config{Host: "http://localhost"}
+
+	t.Run("defaults", func(t *testing.T) {
+		deployer, err := NewDeployer(config, newTestDeployment())
+		require.NoError(t, err)
+		assert.Equal(t, DefaultTimeout, deployer.timeout)
+		assert.Equal(t, "seldon", deployer.namespace)
+		assert.False(t, deployer.dryRun)
+		assert.Nil(t, deployer.dryRunOption())
+		assert.Nil(t, deployer.recorder)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		observer := NewObserver(seldonclientset.NewForConfigOrDie(config), nil, WithResync(time.Minute))
+		recorder := record.NewFakeRecorder(10)
+		deployment := newTestDeployment()
+		deployer, err := NewDeployer(config, deployment,
+			WithTimeout(5*time.Minute),
+			WithNamespace("staging"),
+			WithObserver(observer),
+			WithDryRun(),
+			WithEventRecorder(recorder),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, 5*time.Minute, deployer.timeout)
+		assert.Equal(t, "staging", deployer.namespace)
+		assert.Equal(t, "staging", deployer.deployment.GetNamespace())
+		assert.Equal(t, "seldon", deployment.GetNamespace(), "the given deployment should not be changed")
+		assert.Same(t, observer, deployer.observer)
+		assert.Equal(t, []string{metav1.DryRunAll}, deployer.dryRunOption())
+
+		deployer.recordEvent(v1.EventTypeNormal, "InstructionStarted", "Started instruction %s", "Create")
+		assert.Equal(t, "Normal InstructionStarted Started instruction Create", <-recorder.Events)
+	})
+	t.Run("timeout has to be positive", func(t *testing.T) {
+		for _, timeout := range []time.Duration{0, -time.Second} {
+			_, err := NewDeployer(config, newTestDeployment(), WithTimeout(timeout))
+			assert.True(t, errors.Is(err, ErrValidation), timeout.String())
+		}
+	})
+}
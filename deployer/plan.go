@@ -0,0 +1,113 @@
+package deployer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go-client-k8s/parse"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// planInstructions creates the instructions of a plan by the key they have in it, the name of their type starting in
+// lower case
+var planInstructions = map[string]func() DeploymentInstruction{
+	"create":             func() DeploymentInstruction { return &Create{} },
+	"update":             func() DeploymentInstruction { return &Update{} },
+	"scaleReplicas":      func() DeploymentInstruction { return &ScaleReplicas{} },
+	"delete":             func() DeploymentInstruction { return &Delete{} },
+	"portForward":        func() DeploymentInstruction { return &PortForward{} },
+	"predict":            func() DeploymentInstruction { return &Predict{} },
+	"comparePredictions": func() DeploymentInstruction { return &ComparePredictions{} },
+	"loadTest":           func() DeploymentInstruction { return &LoadTest{} },
+	"sequence":           func() DeploymentInstruction { return &Sequence{} },
+	"parallel":           func() DeploymentInstruction { return &Parallel{} },
+	"if":                 func() DeploymentInstruction { return &If{} },
+	"repeat":             func() DeploymentInstruction { return &Repeat{} },
+}
+
+// Instructions is a list of instructions as written in a plan file: every instruction is an object with a single key,
+// which names the instruction, and its fields as the value, e.g. {"scaleReplicas": {"numReplicas": 2}}. Field names
+// are matched case-insensitively, and unknown instructions or fields are rejected.
+type Instructions []DeploymentInstruction
+
+func (i *Instructions) UnmarshalJSON(data []byte) error {
+	var steps []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return WithKind(ErrValidation, errors.Wrap(err, "instructions have to be a list"))
+	}
+	instructions := make(Instructions, 0, len(steps))
+	for n, step := range steps {
+		if len(step) != 1 {
+			return WithKind(ErrValidation, fmt.Errorf("instruction %d has to have exactly one key, has %d", n+1, len(step)))
+		}
+		for key, fields := range step {
+			instruction, err := unmarshalInstruction(key, fields)
+			if err != nil {
+				return errors.Wrapf(err, "instruction %d (%s)", n+1, key)
+			}
+			instructions = append(instructions, instruction)
+		}
+	}
+	*i = instructions
+	return nil
+}
+
+// MarshalJSON writes the instructions like they are written in a plan file, e.g. for the parameters of a Report
+func (i Instructions) MarshalJSON() ([]byte, error) {
+	steps := make([]map[string]DeploymentInstruction, 0, len(i))
+	for _, instruction := range i {
+		name := instructionName(instruction)
+		steps = append(steps, map[string]DeploymentInstruction{strings.ToLower(name[:1]) + name[1:]: instruction})
+	}
+	return json.Marshal(steps)
+}
+
+func unmarshalInstruction(key string, fields json.RawMessage) (DeploymentInstruction, error) {
+	newInstruction, ok := planInstructions[key]
+	if !ok {
+		known := make([]string, 0, len(planInstructions))
+		for name := range planInstructions {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		return nil, WithKind(ErrValidation, fmt.Errorf("unknown instruction, expected one of %s", strings.Join(known, ", ")))
+	}
+	instruction := newInstruction()
+	if len(fields) == 0 || string(fields) == "null" {
+		return instruction, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(fields))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(instruction); err != nil {
+		return nil, WithKind(ErrValidation, errors.Wrap(err, "invalid fields"))
+	}
+	return instruction, nil
+}
+
+// ReadPlan reads the instructions of a run from a yaml or json plan file. The plan is a list of Instructions.
+func ReadPlan(filepath string) ([]DeploymentInstruction, error) {
+	rawData, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read plan '%s'", filepath)
+	}
+	return ParsePlan(rawData)
+}
+
+// ParsePlan parses the instructions of a yaml or json plan
+func ParsePlan(rawData []byte) ([]DeploymentInstruction, error) {
+	rawJSON, err := parse.ToJSON(rawData)
+	if err != nil {
+		return nil, WithKind(ErrValidation, errors.Wrap(err, "could not parse plan"))
+	}
+	var instructions Instructions
+	if err := json.Unmarshal(rawJSON, &instructions); err != nil {
+		return nil, errors.Wrap(err, "invalid plan")
+	}
+	if len(instructions) == 0 {
+		return nil, WithKind(ErrValidation, fmt.Errorf("plan has no instructions"))
+	}
+	return instructions, nil
+}
@@ -0,0 +1,111 @@
+package deployer
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPlan = `
+- if:
+    condition: {exists: true}
+    then:
+      - update:
+    else:
+      - create: {}
+- repeat:
+    until: {field: spec.replicas, equals: "5"}
+    instructions:
+      - scaleReplicas: {by: 1}
+- parallel:
+    failFast: true
+    instructions:
+      - loadTest: {requestsFile: requests.jsonl, duration: 30s, maxP99: 0.2}
+      - sequence:
+          instructions:
+            - portForward: {predictor: canary}
+            - predict: {requestsFile: requests.jsonl}
+- repeat:
+    times: 2
+    until: {state: Available}
+    instructions:
+      - scaleReplicas: {numReplicas: 2}
+- delete:
+`
+
+func TestParsePlan(t *testing.T) {
+	instructions, err := ParsePlan([]byte(testPlan))
+	require.NoError(t, err)
+	require.Len(t, instructions, 5)
+
+	condition := instructions[0].(*If)
+	require.NotNil(t, condition.Condition.Exists)
+	assert.True(t, *condition.Condition.Exists)
+	assert.Equal(t, Instructions{&Update{}}, condition.Then)
+	assert.Equal(t, Instructions{&Create{}}, condition.Else)
+
+	repeat := instructions[1].(*Repeat)
+	assert.Equal(t, &Condition{Field: "spec.replicas", Equals: "5"}, repeat.Until)
+	assert.Equal(t, Instructions{&ScaleReplicas{By: 1}}, repeat.Instructions)
+
+	parallel := instructions[2].(*Parallel)
+	assert.True(t, parallel.FailFast)
+	require.Len(t, parallel.Instructions, 2)
+	loadTest := parallel.Instructions[0].(*LoadTest)
+	assert.Equal(t, Duration(30*time.Second), loadTest.Duration)
+	assert.Equal(t, Duration(200*time.Millisecond), loadTest.MaxP99)
+	assert.Equal(t, Instructions{&PortForward{Predictor: "canary"}, &Predict{RequestsFile: "requests.jsonl"}},
+		parallel.Instructions[1].(*Sequence).Instructions)
+
+	repeat = instructions[3].(*Repeat)
+	assert.Equal(t, 2, repeat.Times)
+	assert.Equal(t, machinelearningv1.StatusStateAvailable, repeat.Until.State)
+	assert.Equal(t, &Delete{}, instructions[4])
+
+	t.Run("written like it is read", func(t *testing.T) {
+		rawData, err := json.Marshal(Instructions(instructions))
+		require.NoError(t, err)
+		reread, err := ParsePlan(rawData)
+		require.NoError(t, err)
+		assert.Equal(t, instructions, reread)
+	})
+}
+
+func TestParsePlan_Invalid(t *testing.T) {
+	for name, plan := range map[string]string{
+		"not a list":          "create: {}",
+		"empty":               "[]",
+		"unknown instruction": "- deploy: {}",
+		"unknown field":       "- scaleReplicas: {replicas: 2}",
+		"two instructions":    "- {create: {}, delete: {}}",
+		"nested unknown field": `
+- repeat:
+    times: 2
+    instructions:
+      - scaleReplicas: {replicas: 2}`,
+		"invalid duration": "- loadTest: {duration: soon}",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParsePlan([]byte(plan))
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrValidation), err.Error())
+		})
+	}
+}
+
+func TestReadPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(testPlan), 0644))
+	instructions, err := ReadPlan(path)
+	require.NoError(t, err)
+	assert.Len(t, instructions, 5)
+
+	_, err = ReadPlan(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
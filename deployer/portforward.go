@@ -0,0 +1,190 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"go-client-k8s/predict"
+	"io/ioutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// DefaultExecutorPort is the port of the REST API of the Seldon executor (service orchestrator) in predictor pods
+const DefaultExecutorPort = 8000
+
+// PortForwarder opens a port-forward to a port of a pod, and returns the local port it listens on together with a
+// function that tears the port-forward down
+type PortForwarder func(pod *v1.Pod, port int) (localPort int, stop func(), err error)
+
+// SPDYPortForwarder returns a PortForwarder that port-forwards through the API server of config, like
+// `kubectl port-forward` does. It listens on a random free local port.
+func SPDYPortForwarder(config *rest.Config) PortForwarder {
+	return func(pod *v1.Pod, port int) (int, func(), error) {
+		transport, upgrader, err := spdy.RoundTripperFor(config)
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "could not create SPDY round tripper")
+		}
+		hostURL, err := url.Parse(config.Host)
+		if err != nil {
+			return 0, nil, errors.Wrapf(err, "could not parse API server URL '%s'", config.Host)
+		}
+		hostURL.Path = path.Join(hostURL.Path, "api", "v1", "namespaces", pod.Namespace, "pods", pod.Name, "portforward")
+		dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, hostURL)
+
+		stopChan, readyChan := make(chan struct{}), make(chan struct{})
+		forwarder, err := portforward.NewOnAddresses(dialer, []string{"localhost"}, []string{fmt.Sprintf("0:%d", port)},
+			stopChan, readyChan, ioutil.Discard, ioutil.Discard)
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "could not create port-forward")
+		}
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- forwarder.ForwardPorts()
+		}()
+		select {
+		case <-readyChan:
+		case err := <-errChan:
+			return 0, nil, errors.Wrapf(err, "could not port-forward to pod %s", pod.Name)
+		}
+		stop := func() {
+			close(stopChan)
+			<-errChan
+		}
+		ports, err := forwarder.GetPorts()
+		if err != nil {
+			stop()
+			return 0, nil, errors.Wrap(err, "could not get the local port of the port-forward")
+		}
+		return int(ports[0].Local), stop, nil
+	}
+}
+
+// PortForward opens a port-forward to the executor of a ready pod of a predictor of the deployment. Instructions that
+// send requests to the model, e.g. Predict, use it when they are not given a URL. The port-forward is torn down when
+// RunInstructions finishes.
+type PortForward struct {
+	Predictor string // Name of the predictor, the first predictor of the deployment if not given
+	Port      int    // Port in the pod, DefaultExecutorPort or DefaultExecutorGRPCPort if not given
+}
+
+func (p *PortForward) Eventless() {}
+
+// selector returns the label selector of the pods of the predictor, as labelled by the Seldon operator
+func (p *PortForward) selector(deployment *machinelearningv1.SeldonDeployment) (string, error) {
+	for i, predictor := range deployment.Spec.Predictors {
+		if p.Predictor == "" || p.Predictor == predictor.Name {
+			return labels.SelectorFromSet(labels.Set{
+				machinelearningv1.Label_seldon_id:  machinelearningv1.GetSeldonDeploymentName(deployment),
+				machinelearningv1.Label_seldon_app: machinelearningv1.GetPredictorKey(deployment, &deployment.Spec.Predictors[i]),
+			}).String(), nil
+		}
+	}
+	if p.Predictor == "" {
+		return "", WithKind(ErrValidation, fmt.Errorf("deployment has no predictors to port-forward to"))
+	}
+	return "", WithKind(ErrValidation, fmt.Errorf("deployment has no predictor '%s'", p.Predictor))
+}
+
+func (p *PortForward) Do(ctx context.Context, d *Deployer) error {
+	logger := d.logFor(p)
+	if d.kubeClient == nil || d.portForwarder == nil {
+		return WithKind(ErrValidation, fmt.Errorf("port-forward needs a Kubernetes client and a port forwarder"))
+	}
+	selector, err := p.selector(d.deployment)
+	if err != nil {
+		return err
+	}
+	if d.dryRun {
+		logger.Infof("Not port-forwarding to pods matching %s in a dry run", selector)
+		return nil
+	}
+	port := p.Port
+	if port == 0 {
+		port = DefaultExecutorPort
+		if predict.UsesGRPC(d.deployment) {
+			port = DefaultExecutorGRPCPort
+		}
+	}
+
+	logger.Info(ActionLog("Waiting for a ready pod matching %s...", selector))
+	var pod *v1.Pod
+	err = wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		pods, err := d.kubeClient.CoreV1().Pods(d.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return false, errors.Wrap(err, "could not list predictor pods")
+		}
+		pod = readyPod(pods.Items)
+		return pod != nil, nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		return errors.Wrapf(ctx.Err(), "no pod matching %s became ready", selector)
+	}
+	if err != nil {
+		return err
+	}
+
+	localPort, stop, err := d.portForwarder(pod, port)
+	if err != nil {
+		return err
+	}
+	modelURL := fmt.Sprintf("http://localhost:%d", localPort)
+	d.replacePortForward(modelURL, stop)
+	logger.WithField("pod", pod.Name).Infof("Forwarding %s to port %d", modelURL, port)
+	return nil
+}
+
+func (p *PortForward) Done(event Event) (bool, error) {
+	return true, nil
+}
+
+// readyPod returns the first pod that is running, ready and not being deleted, or nil if there is none
+func readyPod(pods []v1.Pod) *v1.Pod {
+	for i, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+				return &pods[i]
+			}
+		}
+	}
+	return nil
+}
+
+// stopPortForward tears down the port-forward opened by a PortForward instruction, if there is one
+func (d *Deployer) stopPortForward() {
+	d.replacePortForward("", nil)
+}
+
+// replacePortForward makes requests to the model go through the port-forward at modelURL, which stop tears down, and
+// tears down the port-forward opened before, if there is one
+func (d *Deployer) replacePortForward(modelURL string, stop func()) {
+	d.mutex.Lock()
+	previousURL, previousStop := d.modelURL, d.portForwardStop
+	d.modelURL, d.portForwardStop = modelURL, stop
+	d.mutex.Unlock()
+	if previousStop != nil {
+		d.log.Debugf("Stopping port-forward to %s", previousURL)
+		previousStop()
+	}
+}
+
+// forwardedURL returns the base URL of the model's REST API through the port-forward, or an empty string if there is
+// no port-forward
+func (d *Deployer) forwardedURL() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.modelURL
+}
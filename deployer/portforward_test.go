@@ -0,0 +1,118 @@
+package deployer
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakePortForwarder forwards every port to server instead of a pod, and counts the port-forwards that are open
+type fakePortForwarder struct {
+	server *url.URL
+	pods   []string
+	open   int
+}
+
+func (f *fakePortForwarder) forward(pod *v1.Pod, port int) (int, func(), error) {
+	localPort, err := strconv.Atoi(f.server.Port())
+	if err != nil {
+		return 0, nil, err
+	}
+	f.pods = append(f.pods, pod.Name)
+	f.open++
+	return localPort, func() { f.open-- }, nil
+}
+
+func newPredictorPod(name, predictorKey string, ready bool) *v1.Pod {
+	readyStatus := v1.ConditionFalse
+	if ready {
+		readyStatus = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "seldon",
+			Labels: map[string]string{
+				machinelearningv1.Label_seldon_id:  "seldon-deployment-example",
+				machinelearningv1.Label_seldon_app: predictorKey,
+			},
+		},
+		Status: v1.PodStatus{
+			Phase:      v1.PodRunning,
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: readyStatus}},
+		},
+	}
+}
+
+func TestDeployer_RunInstructions_PortForward(t *testing.T) {
+	setup := func(t *testing.T, opts ...Option) (*Deployer, *fakePortForwarder) {
+		server := newModelServer(t)
+		serverURL, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		forwarder := &fakePortForwarder{server: serverURL}
+		opts = append([]Option{WithPortForwarder(forwarder.forward), WithHTTPClient(server.Client())}, opts...)
+		deployer, _ := newTestDeployer(t, nil, opts...)
+		deployer.deployment.Spec.Predictors = []machinelearningv1.PredictorSpec{{Name: "canary"}, {Name: "default"}}
+		return deployer, forwarder
+	}
+	createPods := func(t *testing.T, deployer *Deployer, pods ...*v1.Pod) {
+		for _, pod := range pods {
+			_, err := deployer.kubeClient.CoreV1().Pods("seldon").Create(context.Background(), pod, metav1.CreateOptions{})
+			require.NoError(t, err)
+		}
+	}
+
+	t.Run("predictions are sent through a ready pod of the predictor", func(t *testing.T) {
+		deployer, forwarder := setup(t)
+		createPods(t, deployer,
+			newPredictorPod("canary-0", "seldon-deployment-example-canary", true),
+			newPredictorPod("default-0", "seldon-deployment-example-default", false),
+			newPredictorPod("default-1", "seldon-deployment-example-default", true),
+		)
+		predict := &Predict{RequestsFile: writeRequestsFile(t, `{"data":{"ndarray":[[1,2]]}}`)}
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&PortForward{Predictor: "default"}, predict})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"default-1"}, forwarder.pods)
+		require.Len(t, predict.Results, 1)
+		assert.Equal(t, 200, predict.Results[0].StatusCode)
+		assert.Equal(t, 0, forwarder.open, "port-forward should be torn down when the instructions have finished")
+		assert.Empty(t, deployer.modelURL)
+	})
+
+	t.Run("port-forward is torn down after a failure", func(t *testing.T) {
+		deployer, forwarder := setup(t)
+		createPods(t, deployer, newPredictorPod("canary-0", "seldon-deployment-example-canary", true))
+		predict := &Predict{RequestsFile: writeRequestsFile(t, `{"fail":true}`)}
+
+		require.Error(t, deployer.RunInstructions([]DeploymentInstruction{&PortForward{}, predict}))
+		assert.Equal(t, []string{"canary-0"}, forwarder.pods)
+		assert.Equal(t, 0, forwarder.open)
+	})
+
+	t.Run("unknown predictor is a validation error", func(t *testing.T) {
+		deployer, _ := setup(t)
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&PortForward{Predictor: "missing"}})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrValidation))
+	})
+
+	t.Run("times out without a ready pod", func(t *testing.T) {
+		deployer, forwarder := setup(t, WithTimeout(200*time.Millisecond))
+		createPods(t, deployer, newPredictorPod("default-0", "seldon-deployment-example-default", false))
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&PortForward{Predictor: "default"}})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrTimeout))
+		assert.Empty(t, forwarder.pods)
+	})
+}
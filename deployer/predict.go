@@ -0,0 +1,220 @@
+package deployer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go-client-k8s/predict"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// IngressBaseURL returns the base URL of a SeldonDeployment's REST API behind the Seldon ingress (Ambassador or Istio)
+func IngressBaseURL(ingressURL, namespace, name string) string {
+	return fmt.Sprintf("%s/seldon/%s/%s", strings.TrimSuffix(ingressURL, "/"), namespace, name)
+}
+
+// Payload is a request payload read from a JSON Lines file
+type Payload struct {
+	Line int
+	Body json.RawMessage
+}
+
+// ReadPayloads reads a JSON Lines file with a request payload on every line. Empty lines are skipped.
+func ReadPayloads(r io.Reader) ([]Payload, error) {
+	var payloads []Payload
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		body := bytes.TrimSpace(scanner.Bytes())
+		if len(body) == 0 {
+			continue
+		}
+		if !json.Valid(body) {
+			return nil, fmt.Errorf("request payload on line %d is not valid JSON", line)
+		}
+		payloads = append(payloads, Payload{Line: line, Body: append(json.RawMessage{}, body...)})
+	}
+	return payloads, errors.Wrap(scanner.Err(), "could not read request payloads")
+}
+
+func readPayloadsFile(filepath string) ([]Payload, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, WithKind(ErrValidation, errors.Wrapf(err, "could not open requests file '%s'", filepath))
+	}
+	defer file.Close()
+	payloads, err := ReadPayloads(file)
+	if err != nil {
+		return nil, WithKind(ErrValidation, errors.Wrapf(err, "could not read requests file '%s'", filepath))
+	}
+	if len(payloads) == 0 {
+		return nil, WithKind(ErrValidation, fmt.Errorf("requests file '%s' is empty", filepath))
+	}
+	return payloads, nil
+}
+
+// PredictionResult describes how a single prediction request went
+type PredictionResult struct {
+	Line       int             `json:"line"` // Line of the request payload in the requests file
+	StatusCode int             `json:"statusCode,omitempty"`
+	Latency    Duration        `json:"latencySeconds"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+func (r PredictionResult) Failed() bool {
+	return r.Error != ""
+}
+
+// sendPrediction posts a payload to the prediction endpoint at url. Failures are recorded in the result.
+func sendPrediction(ctx context.Context, client *http.Client, url string, payload Payload) (result PredictionResult) {
+	result.Line = payload.Line
+	start := time.Now()
+	defer func() { result.Latency = Duration(time.Since(start)) }()
+
+	statusCode, body, err := predict.PostJSON(ctx, client, url, payload.Body)
+	result.StatusCode = statusCode
+	if json.Valid(body) {
+		result.Response = body
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func errorRate(results []PredictionResult) float64 {
+	if len(results) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Failed() {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(results))
+}
+
+// Predict sends every request payload of a JSON Lines file to the prediction endpoint of the deployed model, and fails
+// if more than MaxErrorRate of the requests fail. Deployments served over gRPC, see predict.UsesGRPC, are sent the
+// payloads over gRPC, written in the JSON mapping of the protocol's messages, which matches its REST API.
+type Predict struct {
+	RequestsFile  string  // JSON Lines file with a request payload on every line
+	BaseURL       string  // Base URL of the model's REST or gRPC API, e.g. http://localhost:8000 for a port-forward to the executor
+	IngressURL    string  // URL of the Seldon ingress, used if BaseURL is not given. Otherwise a PortForward is used
+	MaxErrorRate  float64 // Highest fraction of requests that may fail, between 0 and 1
+	ResponsesFile string  // Optional JSON Lines file to write the result of every request to
+
+	Results []PredictionResult `json:"-"` // Results of the requests sent by the last Do
+}
+
+func (p *Predict) Eventless() {}
+
+// predictionsURL returns the URL of the prediction endpoint at baseURL, behind the ingress at ingressURL or, without
+// either, through the port-forward of an earlier PortForward instruction. The path of the endpoint depends on the
+// protocol the deployment declares, whose Codec is returned as well.
+func predictionsURL(d *Deployer, baseURL, ingressURL string) (string, predict.Codec, error) {
+	codec, err := predict.CodecFor(predict.ProtocolOf(d.deployment))
+	if err != nil {
+		return "", nil, WithKind(ErrValidation, err)
+	}
+	path := codec.Path(predict.ModelName(d.deployment))
+	forwardedURL := d.forwardedURL()
+	switch {
+	case baseURL != "":
+		return strings.TrimSuffix(baseURL, "/") + path, codec, nil
+	case ingressURL != "":
+		return IngressBaseURL(ingressURL, d.namespace, d.name) + path, codec, nil
+	case forwardedURL != "":
+		return forwardedURL + path, codec, nil
+	}
+	return "", nil, WithKind(ErrValidation,
+		fmt.Errorf("sending requests to the model needs a base URL, an ingress URL or an earlier PortForward"))
+}
+
+// sender returns a function that sends a payload to the model, over gRPC if the deployment's graph is served over
+// gRPC and to the REST API otherwise, together with a description of where it sends to and a function that releases
+// its connection
+func (p *Predict) sender(ctx context.Context, d *Deployer) (func(Payload) PredictionResult, string, func(), error) {
+	if !predict.UsesGRPC(d.deployment) {
+		url, _, err := predictionsURL(d, p.BaseURL, p.IngressURL)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return func(payload Payload) PredictionResult {
+			return sendPrediction(ctx, d.httpClient, url, payload)
+		}, url, func() {}, nil
+	}
+	client, conn, ctx, err := dialModel(ctx, d, p.BaseURL, p.IngressURL)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return func(payload Payload) PredictionResult {
+		return sendGRPCPrediction(ctx, client, payload)
+	}, conn.Target() + client.Method(), func() { conn.Close() }, nil
+}
+
+func (p *Predict) Do(ctx context.Context, d *Deployer) error {
+	logger := d.logFor(p)
+	payloads, err := readPayloadsFile(p.RequestsFile)
+	if err != nil {
+		return err
+	}
+	send, target, closeSender, err := p.sender(ctx, d)
+	if err != nil {
+		return err
+	}
+	defer closeSender()
+	if d.dryRun {
+		logger.Infof("Not sending %d requests to %s in a dry run", len(payloads), target)
+		return nil
+	}
+
+	logger.Info(ActionLog("Sending %d requests to %s...", len(payloads), target))
+	p.Results = make([]PredictionResult, 0, len(payloads))
+	for _, payload := range payloads {
+		result := send(payload)
+		if result.Failed() {
+			logger.WithField("line", result.Line).Warn(result.Error)
+		}
+		p.Results = append(p.Results, result)
+	}
+	if p.ResponsesFile != "" {
+		if err := writeResults(p.ResponsesFile, p.Results); err != nil {
+			return err
+		}
+	}
+	logger.WithField("error_rate", errorRate(p.Results)).Infof("Sent %d requests", len(p.Results))
+	return nil
+}
+
+func (p *Predict) Done(event Event) (bool, error) {
+	if rate := errorRate(p.Results); rate > p.MaxErrorRate {
+		return false, fmt.Errorf("%.1f%% of the prediction requests failed, which is more than the allowed %.1f%%",
+			rate*100, p.MaxErrorRate*100)
+	}
+	return true, nil
+}
+
+func writeResults(filepath string, results []PredictionResult) error {
+	file, err := os.Create(filepath)
+	if err != nil {
+		return errors.Wrapf(err, "could not create responses file '%s'", filepath)
+	}
+	encoder := json.NewEncoder(file)
+	for _, result := range results {
+		if err := encoder.Encode(result); err != nil {
+			file.Close()
+			return errors.Wrapf(err, "could not write responses file '%s'", filepath)
+		}
+	}
+	return errors.Wrapf(file.Close(), "could not close responses file '%s'", filepath)
+}
@@ -0,0 +1,148 @@
+package deployer
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-client-k8s/predict"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRequestsFile(t *testing.T, lines ...string) string {
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644))
+	return path
+}
+
+// newModelServer returns a stand-in for the model's REST API that fails requests with a "fail" field
+func newModelServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != predict.SeldonPredictionsPath {
+			http.NotFound(w, r)
+			return
+		}
+		var request map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request["fail"] != nil {
+			http.Error(w, `{"status":{"code":-1,"info":"bad request"}}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"ndarray":[[0.9,0.1]]}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestReadPayloads(t *testing.T) {
+	payloads, err := ReadPayloads(strings.NewReader("{\"data\":{\"ndarray\":[[1]]}}\n\n{\"data\":{\"ndarray\":[[2]]}}\n"))
+	require.NoError(t, err)
+	require.Len(t, payloads, 2)
+	assert.Equal(t, 1, payloads[0].Line)
+	assert.Equal(t, 3, payloads[1].Line)
+	assert.JSONEq(t, `{"data":{"ndarray":[[2]]}}`, string(payloads[1].Body))
+
+	_, err = ReadPayloads(strings.NewReader("{\"data\":{}}\nnot json\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestIngressBaseURL(t *testing.T) {
+	assert.Equal(t, "http://localhost:8003/seldon/seldon/example", IngressBaseURL("http://localhost:8003/", "seldon", "example"))
+}
+
+func TestDeployer_RunInstructions_Predict(t *testing.T) {
+	t.Run("records responses and latencies", func(t *testing.T) {
+		server := newModelServer(t)
+		deployer, _ := newTestDeployer(t, nil, WithHTTPClient(server.Client()))
+		responsesFile := filepath.Join(t.TempDir(), "responses.jsonl")
+		predict := &Predict{
+			RequestsFile:  writeRequestsFile(t, `{"data":{"ndarray":[[1,2]]}}`, `{"data":{"ndarray":[[3,4]]}}`),
+			BaseURL:       server.URL,
+			ResponsesFile: responsesFile,
+		}
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}, predict, &Delete{}}))
+		require.Len(t, predict.Results, 2)
+		for _, result := range predict.Results {
+			assert.Equal(t, http.StatusOK, result.StatusCode)
+			assert.JSONEq(t, `{"data":{"ndarray":[[0.9,0.1]]}}`, string(result.Response))
+			assert.True(t, result.Latency > 0)
+		}
+		assert.Equal(t, 0, deployer.Report().Instructions[1].EventsConsumed)
+
+		file, err := os.Open(responsesFile)
+		require.NoError(t, err)
+		defer file.Close()
+		responses, err := ReadPayloads(file)
+		require.NoError(t, err)
+		assert.Len(t, responses, 2)
+	})
+
+	t.Run("error rate above the threshold fails the plan", func(t *testing.T) {
+		server := newModelServer(t)
+		deployer, clientset := newTestDeployer(t, nil, WithHTTPClient(server.Client()))
+		predict := &Predict{
+			RequestsFile: writeRequestsFile(t, `{"data":{}}`, `{"fail":true}`, `{"data":{}}`, `{"fail":true}`),
+			BaseURL:      server.URL,
+			MaxErrorRate: 0.25,
+		}
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&Create{}, predict, &Delete{}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "50.0% of the prediction requests failed")
+		assert.True(t, errors.Is(err, ErrRolledBack))
+		assert.Equal(t, []InstructionStatus{InstructionPassed, InstructionFailed, InstructionSkipped}, reportStatuses(deployer.Report()))
+		assert.Equal(t, http.StatusBadRequest, predict.Results[1].StatusCode)
+		assert.Equal(t, "delete", actionVerbs(clientset)[len(actionVerbs(clientset))-1])
+	})
+
+	t.Run("error rate within the threshold passes", func(t *testing.T) {
+		server := newModelServer(t)
+		deployer, _ := newTestDeployer(t, nil, WithHTTPClient(server.Client()))
+		predict := &Predict{
+			RequestsFile: writeRequestsFile(t, `{"data":{}}`, `{"fail":true}`),
+			BaseURL:      server.URL,
+			MaxErrorRate: 0.5,
+		}
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{predict}))
+	})
+
+	t.Run("requests are sent to the endpoint of the deployment's protocol", func(t *testing.T) {
+		var paths []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			w.Write([]byte(`{"outputs":[{"name":"predict","shape":[1],"datatype":"INT64","data":[1]}]}`))
+		}))
+		defer server.Close()
+		deployer, _ := newTestDeployer(t, nil, WithHTTPClient(server.Client()))
+		deployer.deployment.Spec.Protocol = predict.V2
+		deployer.deployment.Spec.Predictors = []machinelearningv1.PredictorSpec{{
+			Name:  "default",
+			Graph: machinelearningv1.PredictiveUnit{Name: "classifier"},
+		}}
+		instruction := &Predict{
+			RequestsFile: writeRequestsFile(t, `{"inputs":[{"name":"x","shape":[1,1],"datatype":"FP32","data":[1]}]}`),
+			IngressURL:   server.URL,
+		}
+
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{instruction}))
+		assert.Equal(t, []string{"/seldon/seldon/seldon-deployment-example/v2/models/classifier/infer"}, paths)
+	})
+
+	t.Run("missing endpoint is a validation error", func(t *testing.T) {
+		deployer, _ := newTestDeployer(t, nil)
+
+		err := deployer.RunInstructions([]DeploymentInstruction{&Predict{RequestsFile: writeRequestsFile(t, `{}`)}})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrValidation))
+	})
+}
@@ -0,0 +1,122 @@
+package deployer
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventRecord is a single line of a recording of observed events
+type EventRecord struct {
+	Type       EventType                           `json:"type"`
+	Timestamp  time.Time                           `json:"timestamp"`
+	Deployment *machinelearningv1.SeldonDeployment `json:"deployment"`
+}
+
+// EventWriter writes events as JSON Lines
+type EventWriter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{encoder: json.NewEncoder(w)}
+}
+
+func (w *EventWriter) Write(event Event) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	record := EventRecord{
+		Type:       event.Type,
+		Timestamp:  event.Time,
+		Deployment: event.Deployment,
+	}
+	return errors.Wrap(w.encoder.Encode(record), "could not write event record")
+}
+
+// ReadEvents reads a recording written by an EventWriter
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	// Deployments can easily be larger than the default maximum line length
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record EventRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, errors.Wrapf(err, "could not read event record on line %d", line)
+		}
+		events = append(events, Event{Deployment: record.Deployment, Type: record.Type, Time: record.Timestamp})
+	}
+	return events, errors.Wrap(scanner.Err(), "could not read event records")
+}
+
+type ReplayMode string
+
+const (
+	// ReplayRealTime waits between events as long as the time between them when they were recorded
+	ReplayRealTime ReplayMode = "realtime"
+	// ReplayAsFastAsPossible passes on events as soon as the notify function has returned for the previous one. The
+	// Deployer only queues events there, so this does not wait for them to be consumed
+	ReplayAsFastAsPossible ReplayMode = "fast"
+)
+
+// ReplayObserver is an Observer that replays recorded events instead of observing a cluster, so that the Done logic of
+// instructions can be re-run offline
+type ReplayObserver struct {
+	events     []Event
+	mode       ReplayMode
+	notifyFunc func(Event) error
+	log        log.FieldLogger
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func NewReplayObserver(events []Event, mode ReplayMode, opts ...Option) *ReplayObserver {
+	return &ReplayObserver{
+		events: events,
+		mode:   mode,
+		log:    newOptions(opts).observerLogger().WithField(ComponentField, "replay"),
+		stop:   make(chan struct{}),
+	}
+}
+
+func (r *ReplayObserver) SetNotifyFunc(notifyFunc func(Event) error) {
+	r.notifyFunc = notifyFunc
+}
+
+// Run replays the events until they run out, the notify function returns an error or the replay is stopped
+func (r *ReplayObserver) Run() {
+	for i, event := range r.events {
+		var wait <-chan time.Time
+		if r.mode == ReplayRealTime && i > 0 {
+			wait = time.After(event.Time.Sub(r.events[i-1].Time))
+		} else {
+			wait = time.After(0)
+		}
+		select {
+		case <-wait:
+		case <-r.stop:
+			r.log.Infof("stopped replaying after %d of %d events", i, len(r.events))
+			return
+		}
+		r.log.WithFields(eventFields(event)).Info(DescriptionLog("Replayed event"))
+		if err := r.notifyFunc(event); err != nil {
+			r.log.WithError(err).Errorf("stopped replaying after %d of %d events", i, len(r.events))
+			return
+		}
+	}
+	r.log.Info(EventLog("All events have been replayed"))
+}
+
+// Stop makes Run return before the next event. It is safe to call more than once.
+func (r *ReplayObserver) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
@@ -0,0 +1,71 @@
+package deployer
+
+import (
+	"bytes"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned/fake"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var recording bytes.Buffer
+	deployer, _ := newTestDeployer(t, nil, WithRecording(&recording))
+	instructions := func() []DeploymentInstruction {
+		return []DeploymentInstruction{&Create{}, &ScaleReplicas{NumReplicas: 2}, &Delete{}}
+	}
+	require.NoError(t, deployer.RunInstructions(instructions()))
+
+	events, err := ReadEvents(bytes.NewReader(recording.Bytes()))
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	assert.Equal(t, Added, events[0].Type)
+	assert.Equal(t, "seldon-deployment-example", events[0].Deployment.GetName())
+	assert.False(t, events[0].Time.IsZero())
+	assert.Equal(t, Deleted, events[len(events)-1].Type)
+
+	for _, mode := range []ReplayMode{ReplayAsFastAsPossible, ReplayRealTime} {
+		t.Run(string(mode), func(t *testing.T) {
+			logger, _ := test.NewNullLogger()
+			replay := NewReplayObserver(events, mode, WithObserverLogger(logger))
+			replayer, err := NewDeployerForClients(fake.NewSimpleClientset(), nil, newTestDeployment(),
+				WithObserver(replay), WithLogger(logger), WithTimeout(5*time.Second))
+			require.NoError(t, err)
+			defer replayer.Close()
+
+			require.NoError(t, replayer.RunInstructions(instructions()))
+			for i, instruction := range replayer.Report().Instructions {
+				assert.Equal(t, deployer.Report().Instructions[i].EventsConsumed, instruction.EventsConsumed,
+					"%s should consume the same events when replayed", instruction.Name)
+			}
+		})
+	}
+
+	t.Run("real time replay keeps the time between events", func(t *testing.T) {
+		start := time.Now()
+		events := []Event{
+			{Deployment: newTestDeployment(), Type: Added, Time: start},
+			{Deployment: newTestDeployment(), Type: Updated, Time: start.Add(200 * time.Millisecond)},
+		}
+		events[1].Deployment.Status.State = machinelearningv1.StatusStateAvailable
+
+		var replayed []time.Time
+		replay := NewReplayObserver(events, ReplayRealTime)
+		replay.SetNotifyFunc(func(event Event) error {
+			replayed = append(replayed, time.Now())
+			return nil
+		})
+		replay.Run()
+		require.Len(t, replayed, 2)
+		assert.True(t, replayed[1].Sub(replayed[0]) >= 200*time.Millisecond)
+	})
+}
+
+func TestReadEvents_InvalidLine(t *testing.T) {
+	_, err := ReadEvents(bytes.NewBufferString("{\"type\":\"ADDED\"}\n\nnot json\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 3")
+}
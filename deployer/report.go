@@ -0,0 +1,199 @@
+package deployer
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"reflect"
+	"time"
+)
+
+type InstructionStatus string
+
+const (
+	InstructionPassed  InstructionStatus = "passed"
+	InstructionFailed  InstructionStatus = "failed"
+	InstructionSkipped InstructionStatus = "skipped"
+)
+
+// Duration is a time.Duration that is written as seconds in reports
+type Duration time.Duration
+
+func (d Duration) Seconds() float64 {
+	return time.Duration(d).Seconds()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Seconds())
+}
+
+// UnmarshalJSON reads seconds, like MarshalJSON writes them, or a duration string like "1m30s"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case float64:
+		*d = Duration(value * float64(time.Second))
+	case string:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid duration '%s'", value)
+		}
+		*d = Duration(duration)
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+// InstructionReport describes how a single instruction went during RunInstructions
+type InstructionReport struct {
+	Name           string                 `json:"name"`
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+	Start          time.Time              `json:"start"`
+	End            time.Time              `json:"end"`
+	DoDuration     Duration               `json:"doDurationSeconds"`   // Time until Do returned
+	DoneDuration   Duration               `json:"doneDurationSeconds"` // Time until Done was satisfied, counting from Start
+	EventsConsumed int                    `json:"eventsConsumed"`
+	Status         InstructionStatus      `json:"status"`
+	Error          string                 `json:"error,omitempty"`
+}
+
+// Report is the machine-readable summary of a RunInstructions call
+type Report struct {
+	Deployment   string              `json:"deployment"`
+	Namespace    string              `json:"namespace"`
+	Start        time.Time           `json:"start"`
+	End          time.Time           `json:"end"`
+	Instructions []InstructionReport `json:"instructions"`
+}
+
+func newInstructionReport(instruction DeploymentInstruction) InstructionReport {
+	return InstructionReport{
+		Name:       instructionName(instruction),
+		Parameters: instructionParameters(instruction),
+		Status:     InstructionSkipped,
+	}
+}
+
+func instructionName(instruction DeploymentInstruction) string {
+	t := reflect.TypeOf(instruction)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// instructionParameters returns the exported fields of an instruction, which are the ones that describe it
+func instructionParameters(instruction DeploymentInstruction) map[string]interface{} {
+	rawData, err := json.Marshal(instruction)
+	if err != nil {
+		return nil
+	}
+	var parameters map[string]interface{}
+	if err := json.Unmarshal(rawData, &parameters); err != nil || len(parameters) == 0 {
+		return nil
+	}
+	return parameters
+}
+
+func (r *Report) Failures() int {
+	return r.count(InstructionFailed)
+}
+
+func (r *Report) Skipped() int {
+	return r.count(InstructionSkipped)
+}
+
+func (r *Report) count(status InstructionStatus) int {
+	count := 0
+	for _, instruction := range r.Instructions {
+		if instruction.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errors.Wrap(encoder.Encode(r), "could not write JSON report")
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML, with every instruction as a test case of the deployment's test suite
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      fmt.Sprintf("%s/%s", r.Namespace, r.Deployment),
+		Tests:     len(r.Instructions),
+		Failures:  r.Failures(),
+		Skipped:   r.Skipped(),
+		Time:      formatSeconds(r.End.Sub(r.Start)),
+		Timestamp: r.Start.Format(time.RFC3339),
+	}
+	for i, instruction := range r.Instructions {
+		testCase := junitTestCase{
+			Name:      fmt.Sprintf("%02d %s", i+1, instruction.Name),
+			ClassName: fmt.Sprintf("deployer.%s", r.Deployment),
+			Time:      formatSeconds(time.Duration(instruction.DoneDuration)),
+			SystemOut: fmt.Sprintf("parameters: %v\ndo: %ss\ndone: %ss\nevents consumed: %d",
+				instruction.Parameters, formatSeconds(time.Duration(instruction.DoDuration)),
+				formatSeconds(time.Duration(instruction.DoneDuration)), instruction.EventsConsumed),
+		}
+		switch instruction.Status {
+		case InstructionFailed:
+			testCase.Failure = &junitMessage{Message: instruction.Error, Body: instruction.Error}
+		case InstructionSkipped:
+			testCase.Skipped = &junitMessage{Message: "a previous instruction failed"}
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Wrap(err, "could not write JUnit report")
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return errors.Wrap(err, "could not write JUnit report")
+	}
+	_, err := io.WriteString(w, "\n")
+	return errors.Wrap(err, "could not write JUnit report")
+}
+
+func formatSeconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
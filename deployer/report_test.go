@@ -0,0 +1,75 @@
+package deployer
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestReport() *Report {
+	start := time.Date(2020, 9, 30, 12, 0, 0, 0, time.UTC)
+	scale := newInstructionReport(&ScaleReplicas{NumReplicas: 2})
+	scale.Start = start.Add(3 * time.Second)
+	scale.End = start.Add(5 * time.Second)
+	scale.DoDuration = Duration(100 * time.Millisecond)
+	scale.DoneDuration = Duration(2 * time.Second)
+	scale.Status = InstructionFailed
+	scale.Error = "instruction error-ed before finishing: context deadline exceeded"
+
+	create := newInstructionReport(&Create{})
+	create.Start = start
+	create.End = start.Add(3 * time.Second)
+	create.DoDuration = Duration(250 * time.Millisecond)
+	create.DoneDuration = Duration(3 * time.Second)
+	create.EventsConsumed = 3
+	create.Status = InstructionPassed
+
+	return &Report{
+		Deployment:   "seldon-deployment-example",
+		Namespace:    "seldon",
+		Start:        start,
+		End:          start.Add(5 * time.Second),
+		Instructions: []InstructionReport{create, scale, newInstructionReport(&Delete{})},
+	}
+}
+
+func TestNewInstructionReport(t *testing.T) {
+	report := newInstructionReport(&ScaleReplicas{NumReplicas: 2})
+	assert.Equal(t, "ScaleReplicas", report.Name)
+	assert.Equal(t, map[string]interface{}{"NumReplicas": float64(2)}, report.Parameters)
+	assert.Equal(t, InstructionSkipped, report.Status)
+
+	assert.Nil(t, newInstructionReport(&Create{}).Parameters)
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, newTestReport().WriteJSON(&buf))
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	instructions := decoded["instructions"].([]interface{})
+	require.Len(t, instructions, 3)
+
+	create := instructions[0].(map[string]interface{})
+	assert.Equal(t, "Create", create["name"])
+	assert.Equal(t, 0.25, create["doDurationSeconds"])
+	assert.Equal(t, float64(3), create["doneDurationSeconds"])
+	assert.Equal(t, float64(3), create["eventsConsumed"])
+	assert.Equal(t, "passed", create["status"])
+	assert.Equal(t, "failed", instructions[1].(map[string]interface{})["status"])
+}
+
+func TestReport_WriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, newTestReport().WriteJUnit(&buf))
+
+	out := buf.String()
+	assert.Contains(t, out, `<testsuite name="seldon/seldon-deployment-example" tests="3" failures="1" skipped="1" time="5.000"`)
+	assert.Contains(t, out, `<testcase name="01 Create" classname="deployer.seldon-deployment-example" time="3.000">`)
+	assert.Contains(t, out, `<failure message="instruction error-ed before finishing: context deadline exceeded">`)
+	assert.Contains(t, out, `<skipped message="a previous instruction failed"></skipped>`)
+}
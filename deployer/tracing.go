@@ -0,0 +1,156 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	seldondeployment "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned/typed/machinelearning.seldon.io/v1"
+	"go.opentelemetry.io/otel/api/global"
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/label"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TracerName is the name of the tracer the spans of the Deployer are started with
+const TracerName = "go-client-k8s/deployer"
+
+// Exporters that NewTracerProvider can send spans to
+const (
+	TraceExporterStdout = "stdout"
+	TraceExporterOTLP   = "otlp"
+)
+
+// Attributes of the spans
+const (
+	deploymentKey      = label.Key("seldon.deployment")
+	namespaceKey       = label.Key("seldon.namespace")
+	instructionKey     = label.Key("deployer.instruction")
+	dryRunKey          = label.Key("deployer.dry_run")
+	eventsConsumedKey  = label.Key("deployer.events_consumed")
+	eventTypeKey       = label.Key("seldon.event.type")
+	stateKey           = label.Key("seldon.state")
+	resourceVersionKey = label.Key("seldon.resource_version")
+	replicasKey        = label.Key("seldon.replicas")
+)
+
+// NewTracerProvider creates a tracer provider that exports spans in batches to exporter, TraceExporterStdout or
+// TraceExporterOTLP. address is the address of the OpenTelemetry collector the OTLP exporter sends spans to, the
+// collector's default if empty. The returned function flushes the spans that have not been exported yet and stops the
+// exporter.
+func NewTracerProvider(exporter, address string) (*sdktrace.TracerProvider, func(context.Context) error, error) {
+	var spanExporter export.SpanExporter
+	switch exporter {
+	case TraceExporterStdout:
+		stdoutExporter, err := stdout.NewExporter(stdout.WithPrettyPrint(), stdout.WithoutMetricExport())
+		if err != nil {
+			return nil, nil, err
+		}
+		spanExporter = stdoutExporter
+	case TraceExporterOTLP:
+		otlpOptions := []otlp.ExporterOption{otlp.WithInsecure()}
+		if address != "" {
+			otlpOptions = append(otlpOptions, otlp.WithAddress(address))
+		}
+		otlpExporter, err := otlp.NewExporter(otlpOptions...)
+		if err != nil {
+			return nil, nil, err
+		}
+		spanExporter = otlpExporter
+	default:
+		return nil, nil, WithKind(ErrValidation, fmt.Errorf("unknown trace exporter '%s'", exporter))
+	}
+	processor := sdktrace.NewBatchSpanProcessor(spanExporter)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.New(semconv.ServiceNameKey.String("go-client-k8s"))),
+	)
+	return provider, func(ctx context.Context) error {
+		processor.Shutdown()
+		return spanExporter.Shutdown(ctx)
+	}, nil
+}
+
+func (o *options) tracer() apitrace.Tracer {
+	if o.tracing == nil {
+		return global.Tracer(TracerName)
+	}
+	return o.tracing.Tracer(TracerName)
+}
+
+// endSpan marks span as failed if err is not nil, and ends it
+func endSpan(ctx context.Context, span apitrace.Span, err error) {
+	if err != nil {
+		span.RecordError(ctx, err, apitrace.WithErrorStatus(codes.Error))
+	}
+	span.End()
+}
+
+// addEventToSpan annotates the span of ctx with an observed event, if it changed the state of the deployment
+func addEventToSpan(ctx context.Context, event Event, previous machinelearningv1.StatusState) {
+	deploy := event.Deployment
+	if event.Type == Updated && deploy.Status.State == previous {
+		return
+	}
+	attributes := []label.KeyValue{
+		eventTypeKey.String(string(event.Type)),
+		stateKey.String(string(deploy.Status.State)),
+		resourceVersionKey.String(deploy.ResourceVersion),
+	}
+	if deploy.Spec.Replicas != nil {
+		attributes = append(attributes, replicasKey.Int32(*deploy.Spec.Replicas))
+	}
+	apitrace.SpanFromContext(ctx).AddEventWithTimestamp(ctx, event.Time, string(event.Type), attributes...)
+}
+
+// tracedClient starts a span around every request sent to the Kubernetes API through the client it wraps
+type tracedClient struct {
+	seldondeployment.SeldonDeploymentInterface
+	tracer apitrace.Tracer
+}
+
+func (c *tracedClient) start(ctx context.Context, verb, name string) (context.Context, apitrace.Span) {
+	return c.tracer.Start(ctx, "SeldonDeployments."+verb,
+		apitrace.WithSpanKind(apitrace.SpanKindClient), apitrace.WithAttributes(deploymentKey.String(name)))
+}
+
+func (c *tracedClient) Create(ctx context.Context, deploy *machinelearningv1.SeldonDeployment,
+	opts metav1.CreateOptions) (result *machinelearningv1.SeldonDeployment, err error) {
+	ctx, span := c.start(ctx, "Create", deploy.Name)
+	defer func() { endSpan(ctx, span, err) }()
+	return c.SeldonDeploymentInterface.Create(ctx, deploy, opts)
+}
+
+func (c *tracedClient) Update(ctx context.Context, deploy *machinelearningv1.SeldonDeployment,
+	opts metav1.UpdateOptions) (result *machinelearningv1.SeldonDeployment, err error) {
+	ctx, span := c.start(ctx, "Update", deploy.Name)
+	defer func() { endSpan(ctx, span, err) }()
+	return c.SeldonDeploymentInterface.Update(ctx, deploy, opts)
+}
+
+func (c *tracedClient) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) (err error) {
+	ctx, span := c.start(ctx, "Delete", name)
+	defer func() { endSpan(ctx, span, err) }()
+	return c.SeldonDeploymentInterface.Delete(ctx, name, opts)
+}
+
+func (c *tracedClient) Get(ctx context.Context, name string,
+	opts metav1.GetOptions) (result *machinelearningv1.SeldonDeployment, err error) {
+	ctx, span := c.start(ctx, "Get", name)
+	defer func() { endSpan(ctx, span, err) }()
+	return c.SeldonDeploymentInterface.Get(ctx, name, opts)
+}
+
+func (c *tracedClient) Patch(ctx context.Context, name string, pt types.PatchType, data []byte,
+	opts metav1.PatchOptions, subresources ...string) (result *machinelearningv1.SeldonDeployment, err error) {
+	ctx, span := c.start(ctx, "Patch", name)
+	defer func() { endSpan(ctx, span, err) }()
+	return c.SeldonDeploymentInterface.Patch(ctx, name, pt, data, opts, subresources...)
+}
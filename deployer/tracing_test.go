@@ -0,0 +1,86 @@
+package deployer
+
+import (
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-client-k8s/deployertest"
+	"go.opentelemetry.io/otel/codes"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/export/trace/tracetest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"testing"
+)
+
+func newTestTracerProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
+
+// spansByName returns the exported spans by their name. Spans with the same name are in the order they ended in.
+func spansByName(exporter *tracetest.InMemoryExporter) map[string][]*export.SpanData {
+	spans := make(map[string][]*export.SpanData)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = append(spans[span.Name], span)
+	}
+	return spans
+}
+
+func spanEventNames(span *export.SpanData) []string {
+	var names []string
+	for _, event := range span.MessageEvents {
+		names = append(names, event.Name)
+	}
+	return names
+}
+
+func TestDeployer_RunInstructions_Tracing(t *testing.T) {
+	t.Run("a run is a trace with a span for each instruction", func(t *testing.T) {
+		provider, exporter := newTestTracerProvider()
+		deployer, _ := newTestDeployer(t, nil, WithTracerProvider(provider))
+		require.NoError(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}, &ScaleReplicas{NumReplicas: 3}, &Delete{}}))
+
+		spans := spansByName(exporter)
+		require.Len(t, spans["RunInstructions"], 1)
+		run := spans["RunInstructions"][0]
+		assert.False(t, run.ParentSpanID.IsValid())
+		for _, name := range []string{"Create", "ScaleReplicas", "Delete"} {
+			require.Len(t, spans[name], 1, name)
+			assert.Equal(t, run.SpanContext.TraceID, spans[name][0].SpanContext.TraceID, name)
+			assert.Equal(t, run.SpanContext.SpanID, spans[name][0].ParentSpanID, name)
+		}
+
+		create := spans["Create"][0]
+		require.Len(t, spans["SeldonDeployments.Create"], 1)
+		assert.Equal(t, create.SpanContext.SpanID, spans["SeldonDeployments.Create"][0].ParentSpanID)
+		scale := spans["ScaleReplicas"][0]
+		require.Len(t, spans["SeldonDeployments.Get"], 1)
+		assert.Equal(t, scale.SpanContext.SpanID, spans["SeldonDeployments.Get"][0].ParentSpanID)
+		require.Len(t, spans["SeldonDeployments.Update"], 1)
+		assert.Equal(t, scale.SpanContext.SpanID, spans["SeldonDeployments.Update"][0].ParentSpanID)
+
+		// The operator moves the deployment from Creating to Available
+		require.Len(t, spans["WaitForEvent"], 3)
+		wait := spans["WaitForEvent"][0]
+		assert.Equal(t, create.SpanContext.SpanID, wait.ParentSpanID)
+		assert.Equal(t, []string{string(Added), string(Updated)}, spanEventNames(wait)[:2])
+		assert.Equal(t, []string{string(Deleted)}, spanEventNames(spans["WaitForEvent"][2]))
+	})
+
+	t.Run("failed instructions mark their spans as errors", func(t *testing.T) {
+		provider, exporter := newTestTracerProvider()
+		operatorOpts := []deployertest.OperatorOption{deployertest.WithFailure(func(*machinelearningv1.SeldonDeployment) (bool, string) {
+			return true, "Failed to pull image"
+		})}
+		deployer, _ := newTestDeployer(t, operatorOpts, WithTracerProvider(provider))
+		require.Error(t, deployer.RunInstructions([]DeploymentInstruction{&Create{}}))
+
+		spans := spansByName(exporter)
+		require.Len(t, spans["Create"], 1)
+		assert.Equal(t, codes.Error, spans["Create"][0].StatusCode)
+		assert.Equal(t, codes.Error, spans["RunInstructions"][0].StatusCode)
+		// The rollback is part of the trace of the run
+		require.Len(t, spans["SeldonDeployments.Delete"], 1)
+		assert.Equal(t, spans["RunInstructions"][0].SpanContext.SpanID, spans["SeldonDeployments.Delete"][0].ParentSpanID)
+	})
+}
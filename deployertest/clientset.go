@@ -0,0 +1,80 @@
+package deployertest
+
+import (
+	"github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned/fake"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+)
+
+// NewClientset returns a fake Seldon clientset that sets a new resource version on every write, and a new generation
+// on every write that changes the spec, like the API server does. The generated fake clientset leaves both alone, so
+// the Observer would ignore every update.
+func NewClientset(objects ...runtime.Object) *fake.Clientset {
+	clientset := fake.NewSimpleClientset(objects...)
+	clientset.PrependReactor("*", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		// Both create and update actions carry the object that is about to be stored
+		objectAction, ok := action.(k8stesting.CreateAction)
+		if !ok {
+			return false, nil, nil
+		}
+		// The object of the action is the one the caller passed in, so a copy is stored and returned instead
+		object := objectAction.GetObject().DeepCopyObject()
+		accessor, err := meta.Accessor(object)
+		if err != nil {
+			return false, nil, nil
+		}
+		accessor.SetResourceVersion(nextResourceVersion())
+		accessor.SetGeneration(nextGeneration(clientset.Tracker(), objectAction, object))
+		switch a := action.(type) {
+		case k8stesting.CreateActionImpl:
+			a.Object = object
+			action = a
+		case k8stesting.UpdateActionImpl:
+			a.Object = object
+			action = a
+		default:
+			return false, nil, nil
+		}
+		return k8stesting.ObjectReaction(clientset.Tracker())(action)
+	})
+	return clientset
+}
+
+// nextGeneration returns the generation of the object of a create or update action once it is stored: 1 when it is
+// created, and one more than the stored generation when its spec is changed
+func nextGeneration(tracker k8stesting.ObjectTracker, action k8stesting.CreateAction, object runtime.Object) int64 {
+	accessor, _ := meta.Accessor(object)
+	if action.GetVerb() != "update" {
+		return 1
+	}
+	stored, err := tracker.Get(action.GetResource(), action.GetNamespace(), accessor.GetName())
+	if err != nil {
+		return accessor.GetGeneration()
+	}
+	storedAccessor, err := meta.Accessor(stored)
+	if err != nil {
+		return accessor.GetGeneration()
+	}
+	if specOf(stored) == nil || reflect.DeepEqual(specOf(stored), specOf(object)) {
+		return storedAccessor.GetGeneration()
+	}
+	return storedAccessor.GetGeneration() + 1
+}
+
+func specOf(object runtime.Object) interface{} {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		return nil
+	}
+	return content["spec"]
+}
+
+var resourceVersion int64
+
+func nextResourceVersion() string {
+	return strconv.FormatInt(atomic.AddInt64(&resourceVersion, 1), 10)
+}
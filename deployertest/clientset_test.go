@@ -0,0 +1,37 @@
+package deployertest
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestNewClientset(t *testing.T) {
+	client := NewClientset().MachinelearningV1().SeldonDeployments("seldon")
+	ctx := context.Background()
+
+	deployment := newDeployment("seldonio/sklearn-iris:0.1")
+	created, err := client.Create(ctx, deployment, metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.ResourceVersion)
+	assert.Equal(t, int64(1), created.Generation)
+	assert.Empty(t, deployment.ResourceVersion, "the object passed in should be left alone, like with the API server")
+	assert.Zero(t, deployment.Generation)
+
+	created.Status.Description = "status only"
+	statusUpdated, err := client.Update(ctx, created, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.NotEqual(t, created.ResourceVersion, statusUpdated.ResourceVersion)
+	assert.Equal(t, int64(1), statusUpdated.Generation)
+	stored, err := client.Get(ctx, created.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, statusUpdated.ResourceVersion, stored.ResourceVersion)
+
+	replicas := int32(2)
+	statusUpdated.Spec.Replicas = &replicas
+	specUpdated, err := client.Update(ctx, statusUpdated, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), specUpdated.Generation)
+}
@@ -0,0 +1,312 @@
+/*
+Package deployertest provides a simulated Seldon operator, so that instruction plans, timeouts and rollbacks of the
+deployer can be tested deterministically in go test, without a cluster.
+*/
+package deployertest
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/retry"
+	"sync"
+	"time"
+)
+
+// Condition decides whether the operator fails a SeldonDeployment, and if so why
+type Condition func(deployment *machinelearningv1.SeldonDeployment) (failed bool, reason string)
+
+// UnknownImage fails SeldonDeployments that use an image that is not one of the known images
+func UnknownImage(knownImages ...string) Condition {
+	known := map[string]bool{}
+	for _, image := range knownImages {
+		known[image] = true
+	}
+	return func(deployment *machinelearningv1.SeldonDeployment) (bool, string) {
+		for _, predictor := range deployment.Spec.Predictors {
+			for _, componentSpec := range predictor.ComponentSpecs {
+				if componentSpec == nil {
+					continue
+				}
+				for _, container := range componentSpec.Spec.Containers {
+					if !known[container.Image] {
+						return true, fmt.Sprintf("Failed to pull image %s", container.Image)
+					}
+				}
+			}
+		}
+		return false, ""
+	}
+}
+
+type OperatorOption func(*Operator)
+
+// WithCreateDelay sets how long a created SeldonDeployment stays Creating before it becomes Available or Failed
+func WithCreateDelay(delay time.Duration) OperatorOption {
+	return func(o *Operator) {
+		o.createDelay = delay
+	}
+}
+
+// WithScaleDelay sets how long it takes for new replicas to become available
+func WithScaleDelay(delay time.Duration) OperatorOption {
+	return func(o *Operator) {
+		o.scaleDelay = delay
+	}
+}
+
+// WithDeleteDelay sets how long a deleted SeldonDeployment is kept terminating before it is removed
+func WithDeleteDelay(delay time.Duration) OperatorOption {
+	return func(o *Operator) {
+		o.deleteDelay = delay
+	}
+}
+
+// WithFailure makes the operator fail SeldonDeployments that meet condition, instead of making them Available
+func WithFailure(condition Condition) OperatorOption {
+	return func(o *Operator) {
+		o.failures = append(o.failures, condition)
+	}
+}
+
+// Operator simulates the Seldon operator on top of a fake clientset. It moves created SeldonDeployments from Creating
+// to Available (or Failed), makes changed replicas available, moves SeldonDeployments whose spec changed otherwise
+// through Creating again and removes deleted SeldonDeployments, each after a configurable delay.
+type Operator struct {
+	clientset   *fake.Clientset
+	createDelay time.Duration
+	scaleDelay  time.Duration
+	deleteDelay time.Duration
+	failures    []Condition
+
+	mutex     sync.Mutex
+	pending   map[string]bool  // Keys of the SeldonDeployments with a transition in progress
+	rolledOut map[string]int64 // Generation of the spec each SeldonDeployment was last made Available with
+	wg        sync.WaitGroup
+}
+
+func NewOperator(clientset *fake.Clientset, opts ...OperatorOption) *Operator {
+	operator := &Operator{
+		clientset:   clientset,
+		createDelay: 50 * time.Millisecond,
+		scaleDelay:  50 * time.Millisecond,
+		pending:     map[string]bool{},
+		rolledOut:   map[string]int64{},
+	}
+	for _, opt := range opts {
+		opt(operator)
+	}
+	return operator
+}
+
+// Start starts watching SeldonDeployments in all namespaces and returns once the watch is established, so that no
+// SeldonDeployment created afterwards is missed. The operator stops when ctx is cancelled.
+func (o *Operator) Start(ctx context.Context) error {
+	watcher, err := o.clientset.MachinelearningV1().SeldonDeployments(metav1.NamespaceAll).Watch(ctx, metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "could not watch seldon deployments")
+	}
+	if o.deleteDelay > 0 {
+		o.clientset.PrependReactor("delete", "seldondeployments", o.delayDeletion(ctx))
+	}
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		defer watcher.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.ResultChan():
+				if !ok {
+					return
+				}
+				o.handle(ctx, event)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Wait blocks until the operator has stopped and all transitions in progress have been abandoned
+func (o *Operator) Wait() {
+	o.wg.Wait()
+}
+
+func (o *Operator) handle(ctx context.Context, event watch.Event) {
+	deployment, ok := event.Object.(*machinelearningv1.SeldonDeployment)
+	if !ok || event.Type == watch.Deleted || deployment.DeletionTimestamp != nil {
+		return
+	}
+	switch deployment.Status.State {
+	case "":
+		o.transition(ctx, deployment, 0, func(deployment *machinelearningv1.SeldonDeployment) {
+			deployment.Status.State = machinelearningv1.StatusStateCreating
+			deployment.Status.Description = "Creating deployment"
+		})
+	case machinelearningv1.StatusStateCreating:
+		o.transition(ctx, deployment, o.createDelay, o.finishCreating)
+	case machinelearningv1.StatusStateAvailable:
+		switch {
+		case deployment.Status.Replicas != desiredReplicas(deployment):
+			o.transition(ctx, deployment, o.scaleDelay, o.scale)
+		case o.specChanged(deployment):
+			o.transition(ctx, deployment, 0, func(deployment *machinelearningv1.SeldonDeployment) {
+				deployment.Status.State = machinelearningv1.StatusStateCreating
+				deployment.Status.Description = "Updating deployment"
+			})
+		}
+	}
+}
+
+// specChanged returns whether the spec of an Available SeldonDeployment has changed since it was made Available, so
+// that it has to be rolled out again like the Seldon operator does. The first spec seen is taken as rolled out.
+func (o *Operator) specChanged(deployment *machinelearningv1.SeldonDeployment) bool {
+	key := deployment.Namespace + "/" + deployment.Name
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	generation, ok := o.rolledOut[key]
+	if !ok {
+		o.rolledOut[key] = deployment.Generation
+		return false
+	}
+	return deployment.Generation != generation
+}
+
+// markRolledOut records that deployment is Available with its current spec
+func (o *Operator) markRolledOut(deployment *machinelearningv1.SeldonDeployment) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.rolledOut[deployment.Namespace+"/"+deployment.Name] = deployment.Generation
+}
+
+// transition changes the status of deployment after delay, unless a transition is already in progress for it
+func (o *Operator) transition(ctx context.Context, deployment *machinelearningv1.SeldonDeployment, delay time.Duration,
+	change func(*machinelearningv1.SeldonDeployment)) {
+	key := deployment.Namespace + "/" + deployment.Name
+	o.mutex.Lock()
+	if o.pending[key] {
+		o.mutex.Unlock()
+		return
+	}
+	o.pending[key] = true
+	o.mutex.Unlock()
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		// Released before updating, so that the event of the update can start the next transition
+		o.mutex.Lock()
+		delete(o.pending, key)
+		o.mutex.Unlock()
+		_ = o.updateStatus(ctx, deployment.Namespace, deployment.Name, change)
+	}()
+}
+
+func (o *Operator) updateStatus(ctx context.Context, namespace, name string, change func(*machinelearningv1.SeldonDeployment)) error {
+	client := o.clientset.MachinelearningV1().SeldonDeployments(namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := client.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if deployment.DeletionTimestamp != nil {
+			return nil
+		}
+		change(deployment)
+		_, err = client.Update(ctx, deployment, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (o *Operator) finishCreating(deployment *machinelearningv1.SeldonDeployment) {
+	for _, failure := range o.failures {
+		if failed, reason := failure(deployment); failed {
+			deployment.Status.State = machinelearningv1.StatusStateFailed
+			deployment.Status.Description = reason
+			return
+		}
+	}
+	o.scale(deployment)
+	deployment.Status.State = machinelearningv1.StatusStateAvailable
+	deployment.Status.Description = ""
+}
+
+func (o *Operator) scale(deployment *machinelearningv1.SeldonDeployment) {
+	setReplicas(deployment)
+	o.markRolledOut(deployment)
+}
+
+// setReplicas makes the desired replicas of every predictor available
+func setReplicas(deployment *machinelearningv1.SeldonDeployment) {
+	deployment.Status.DeploymentStatus = map[string]machinelearningv1.DeploymentStatus{}
+	replicas := desiredReplicas(deployment)
+	for _, predictor := range deployment.Spec.Predictors {
+		name := fmt.Sprintf("%s-%s", deployment.Name, predictor.Name)
+		deployment.Status.DeploymentStatus[name] = machinelearningv1.DeploymentStatus{
+			Name:              name,
+			Status:            string(machinelearningv1.StatusStateAvailable),
+			Replicas:          replicas,
+			AvailableReplicas: replicas,
+		}
+	}
+	deployment.Status.Replicas = replicas
+}
+
+// desiredReplicas returns the replicas of the SeldonDeployment, which override those of its first predictor
+func desiredReplicas(deployment *machinelearningv1.SeldonDeployment) int32 {
+	if deployment.Spec.Replicas != nil {
+		return *deployment.Spec.Replicas
+	}
+	if len(deployment.Spec.Predictors) > 0 && deployment.Spec.Predictors[0].Replicas != nil {
+		return *deployment.Spec.Predictors[0].Replicas
+	}
+	return 1
+}
+
+// delayDeletion marks deleted SeldonDeployments as terminating and only removes them after the delete delay
+func (o *Operator) delayDeletion(ctx context.Context) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deleteAction := action.(k8stesting.DeleteAction)
+		tracker := o.clientset.Tracker()
+		obj, err := tracker.Get(action.GetResource(), action.GetNamespace(), deleteAction.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		deployment := obj.(*machinelearningv1.SeldonDeployment).DeepCopy()
+		if deployment.DeletionTimestamp != nil {
+			return true, nil, nil
+		}
+		now := metav1.Now()
+		deployment.DeletionTimestamp = &now
+		// The tracker is used directly as the fake clientset cannot be called from within a reactor
+		deployment.ResourceVersion = nextResourceVersion()
+		if err := tracker.Update(action.GetResource(), deployment, action.GetNamespace()); err != nil {
+			return true, nil, err
+		}
+
+		o.wg.Add(1)
+		go func() {
+			defer o.wg.Done()
+			select {
+			case <-time.After(o.deleteDelay):
+			case <-ctx.Done():
+			}
+			// The deletion may have been completed already, e.g. by a second delete
+			_ = tracker.Delete(action.GetResource(), action.GetNamespace(), deleteAction.GetName())
+		}()
+		return true, nil, nil
+	}
+}
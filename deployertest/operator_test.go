@@ -0,0 +1,125 @@
+package deployertest
+
+import (
+	"context"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	seldondeployment "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned/typed/machinelearning.seldon.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func newDeployment(image string) *machinelearningv1.SeldonDeployment {
+	return &machinelearningv1.SeldonDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "seldon"},
+		Spec: machinelearningv1.SeldonDeploymentSpec{
+			Predictors: []machinelearningv1.PredictorSpec{{
+				Name: "default",
+				ComponentSpecs: []*machinelearningv1.SeldonPodSpec{{
+					Spec: v1.PodSpec{Containers: []v1.Container{{Image: image}}},
+				}},
+			}},
+		},
+	}
+}
+
+func startOperator(t *testing.T, opts ...OperatorOption) seldondeployment.SeldonDeploymentInterface {
+	clientset := NewClientset()
+	operator := NewOperator(clientset, opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, operator.Start(ctx))
+	t.Cleanup(func() {
+		cancel()
+		operator.Wait()
+	})
+	return clientset.MachinelearningV1().SeldonDeployments("seldon")
+}
+
+func waitForState(t *testing.T, client seldondeployment.SeldonDeploymentInterface, state machinelearningv1.StatusState) *machinelearningv1.SeldonDeployment {
+	var deployment *machinelearningv1.SeldonDeployment
+	require.Eventually(t, func() bool {
+		var err error
+		deployment, err = client.Get(context.Background(), "example", metav1.GetOptions{})
+		return err == nil && deployment.Status.State == state
+	}, time.Second, 10*time.Millisecond, "deployment should become %s", state)
+	return deployment
+}
+
+func TestOperator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("created deployment becomes available", func(t *testing.T) {
+		client := startOperator(t, WithCreateDelay(100*time.Millisecond))
+		created, err := client.Create(ctx, newDeployment("seldonio/sklearn-iris:0.12"), metav1.CreateOptions{})
+		require.NoError(t, err)
+		assert.NotEmpty(t, created.ResourceVersion)
+
+		waitForState(t, client, machinelearningv1.StatusStateCreating)
+		deployment := waitForState(t, client, machinelearningv1.StatusStateAvailable)
+		assert.Equal(t, int32(1), deployment.Status.Replicas)
+		assert.Equal(t, int32(1), deployment.Status.DeploymentStatus["example-default"].AvailableReplicas)
+		assert.NotEqual(t, created.ResourceVersion, deployment.ResourceVersion)
+	})
+
+	t.Run("deployment with unknown image fails", func(t *testing.T) {
+		client := startOperator(t, WithFailure(UnknownImage("seldonio/sklearn-iris:0.12")))
+		_, err := client.Create(ctx, newDeployment("seldonio/sklearn-iris:0.1"), metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		deployment := waitForState(t, client, machinelearningv1.StatusStateFailed)
+		assert.Equal(t, "Failed to pull image seldonio/sklearn-iris:0.1", deployment.Status.Description)
+	})
+
+	t.Run("scaled replicas become available", func(t *testing.T) {
+		client := startOperator(t, WithScaleDelay(100*time.Millisecond))
+		_, err := client.Create(ctx, newDeployment("seldonio/sklearn-iris:0.12"), metav1.CreateOptions{})
+		require.NoError(t, err)
+		deployment := waitForState(t, client, machinelearningv1.StatusStateAvailable)
+
+		replicas := int32(3)
+		deployment.Spec.Replicas = &replicas
+		_, err = client.Update(ctx, deployment, metav1.UpdateOptions{})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			deployment, err := client.Get(ctx, "example", metav1.GetOptions{})
+			return err == nil && deployment.Status.DeploymentStatus["example-default"].AvailableReplicas == 3
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("updated spec is rolled out again", func(t *testing.T) {
+		client := startOperator(t, WithCreateDelay(100*time.Millisecond))
+		_, err := client.Create(ctx, newDeployment("seldonio/sklearn-iris:0.12"), metav1.CreateOptions{})
+		require.NoError(t, err)
+		deployment := waitForState(t, client, machinelearningv1.StatusStateAvailable)
+
+		deployment.Spec.Predictors[0].ComponentSpecs[0].Spec.Containers[0].Image = "seldonio/sklearn-iris:0.13"
+		_, err = client.Update(ctx, deployment, metav1.UpdateOptions{})
+		require.NoError(t, err)
+
+		deployment = waitForState(t, client, machinelearningv1.StatusStateCreating)
+		assert.Equal(t, "Updating deployment", deployment.Status.Description)
+		waitForState(t, client, machinelearningv1.StatusStateAvailable)
+	})
+
+	t.Run("deleted deployment is terminating before it is removed", func(t *testing.T) {
+		client := startOperator(t, WithDeleteDelay(200*time.Millisecond))
+		_, err := client.Create(ctx, newDeployment("seldonio/sklearn-iris:0.12"), metav1.CreateOptions{})
+		require.NoError(t, err)
+		waitForState(t, client, machinelearningv1.StatusStateAvailable)
+
+		require.NoError(t, client.Delete(ctx, "example", metav1.DeleteOptions{}))
+		deployment, err := client.Get(ctx, "example", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotNil(t, deployment.DeletionTimestamp)
+
+		require.Eventually(t, func() bool {
+			_, err := client.Get(ctx, "example", metav1.GetOptions{})
+			return k8serrors.IsNotFound(err)
+		}, time.Second, 10*time.Millisecond)
+	})
+}
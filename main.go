@@ -1,14 +1,40 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/pkg/errors"
 	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	seldonclientset "github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned"
+	"github.com/seldonio/seldon-core/operator/client/machinelearning.seldon.io/v1/clientset/versioned/fake"
+	"google.golang.org/grpc"
+	"io"
 	"io/ioutil"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	log "github.com/sirupsen/logrus"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"go-client-k8s/deployer"
 	"go-client-k8s/parse"
+	"go-client-k8s/predict"
+	"time"
+)
+
+// Exit codes that CI pipelines can rely on to tell apart why a run has failed
+const (
+	exitOK = iota
+	exitSetupError
+	exitValidationError
+	exitTimeout
+	exitClusterError
+	exitRolledBack
+	exitInterrupted
 )
 
 func logWithTrace(err error) {
@@ -18,26 +44,249 @@ func logWithTrace(err error) {
 }
 
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	var err error
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == predictCommand:
+		err = runPredict()
+	case len(os.Args) > 1 && os.Args[1] == controllerCommand:
+		err = runController()
+	default:
+		err = runInstructions()
+	}
+	code := exitCode(err)
+	if err != nil {
+		log.Debugf("%+v", err)
+		log.Errorf("Run failed with exit code %d: %s", code, err)
+		return code
+	}
+	log.Info("Run finished successfully")
+	return code
+}
 
+func runInstructions() error {
 	parser := parse.NewClientParser()
 	args, err := parser.Parse(os.Args)
-	logWithTrace(err)
+	if err != nil {
+		return deployer.WithKind(deployer.ErrValidation, errors.Wrap(err, "could not parse command line arguments"))
+	}
 
-	config, err := clientcmd.BuildConfigFromFlags("", *args.Kubeconfig)
-	logWithTrace(err)
+	if err := configureLogging(*args.LogFormat, *args.Debug, *args.DeployerLogLevel, *args.ObserverLogLevel); err != nil {
+		return err
+	}
 
 	deployment, err := getSeldonDeployment(*args.DeployConfig)
-	logWithTrace(err)
+	if err != nil {
+		return deployer.WithKind(deployer.ErrValidation, err)
+	}
+	plan := instructions(args)
+	if *args.Plan != "" {
+		if plan, err = deployer.ReadPlan(*args.Plan); err != nil {
+			return deployer.WithKind(deployer.ErrValidation, err)
+		}
+	}
 
-	customResourceDeployer, err := deployer.NewDeployer(config, deployment, *args.Debug)
-	logWithTrace(err)
+	options := []deployer.Option{
+		deployer.WithTimeout(time.Duration(*args.Timeout) * time.Second),
+	}
+	if *args.DryRun {
+		options = append(options, deployer.WithDryRun())
+	}
+	if *args.LeaderElect && *args.Replay != "" {
+		return deployer.WithKind(deployer.ErrValidation, fmt.Errorf("a replayed run cannot take part in a leader election"))
+	}
+	if *args.Record != "" {
+		recording, err := os.Create(*args.Record)
+		if err != nil {
+			return errors.Wrapf(err, "could not create recording '%s'", *args.Record)
+		}
+		defer recording.Close()
+		options = append(options, deployer.WithRecording(recording))
+	}
+	endpointOptions, stopServing := serveEndpoints(*args.MetricsAddress, *args.HealthAddress)
+	defer stopServing()
+	options = append(options, endpointOptions...)
+	if *args.TraceExporter != "none" {
+		provider, shutdown, err := deployer.NewTracerProvider(*args.TraceExporter, *args.OTLPAddress)
+		if err != nil {
+			return errors.Wrap(err, "could not create trace exporter")
+		}
+		defer flushTraces(shutdown)
+		options = append(options, deployer.WithTracerProvider(provider))
+	}
 
-	err = customResourceDeployer.RunInstructions([]deployer.DeploymentInstruction{
+	customResourceDeployer, err := newDeployer(args, deployment, options)
+	if err != nil {
+		return errors.Wrap(err, "could not create deployer")
+	}
+	defer customResourceDeployer.Close()
+
+	if *args.LeaderElect {
+		err = runAsLeader(args.Kubeconfig, args.LeaderElectionArgs, func(ctx context.Context) error {
+			return customResourceDeployer.RunInstructionsContext(ctx, plan)
+		})
+	} else {
+		err = customResourceDeployer.RunInstructions(plan)
+	}
+	reportErr := writeReports(customResourceDeployer.Report(), args)
+	if err != nil {
+		logWithTrace(reportErr)
+		return err
+	}
+	return reportErr
+}
+
+// instructions returns the instructions of a run. Predictions are only sent to the model, compared and load tested
+// if a requests file is given.
+func instructions(args parse.ClientArgs) []deployer.DeploymentInstruction {
+	instructions := []deployer.DeploymentInstruction{
 		&deployer.Create{},
 		&deployer.ScaleReplicas{NumReplicas: 2},
-		&deployer.Delete{},
-	})
-	logWithTrace(err)
+	}
+	if *args.Requests != "" {
+		if *args.PortForward {
+			instructions = append(instructions, &deployer.PortForward{Predictor: *args.Predictor})
+		}
+		instructions = append(instructions, &deployer.Predict{
+			RequestsFile:  *args.Requests,
+			BaseURL:       *args.PredictURL,
+			IngressURL:    *args.IngressURL,
+			MaxErrorRate:  *args.MaxErrorRate,
+			ResponsesFile: *args.Responses,
+		})
+		if *args.ReferenceURL != "" {
+			instructions = append(instructions, &deployer.ComparePredictions{
+				RequestsFile: *args.Requests,
+				BaseURL:      *args.PredictURL,
+				IngressURL:   *args.IngressURL,
+				ReferenceURL: *args.ReferenceURL,
+				Comparison:   *args.Comparison,
+				Tolerance:    *args.Tolerance,
+				MinAgreement: *args.MinAgreement,
+			})
+		}
+		if *args.LoadTest > 0 {
+			instructions = append(instructions, &deployer.LoadTest{
+				RequestsFile: *args.Requests,
+				BaseURL:      *args.PredictURL,
+				IngressURL:   *args.IngressURL,
+				Duration:     deployer.Duration(time.Duration(*args.LoadTest) * time.Second),
+				RPS:          *args.RPS,
+				Concurrency:  *args.Concurrency,
+				MaxP99:       deployer.Duration(time.Duration(*args.MaxP99) * time.Millisecond),
+				MaxErrorRate: *args.MaxErrorRate,
+			})
+		}
+	}
+	return append(instructions, &deployer.Delete{})
+}
+
+// newDeployer creates a deployer for the cluster of the kubeconfig or, when replaying a recording, a deployer that
+// consumes the recorded events and sends its requests to a fake clientset instead of a cluster
+func newDeployer(args parse.ClientArgs, deployment *machinelearningv1.SeldonDeployment, options []deployer.Option) (*deployer.Deployer, error) {
+	if *args.Replay != "" {
+		file, err := os.Open(*args.Replay)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not open recording '%s'", *args.Replay)
+		}
+		defer file.Close()
+		events, err := deployer.ReadEvents(file)
+		if err != nil {
+			return nil, deployer.WithKind(deployer.ErrValidation, err)
+		}
+		replay := deployer.NewReplayObserver(events, deployer.ReplayMode(*args.ReplayMode))
+		options = append(options, deployer.WithObserver(replay))
+		return deployer.NewDeployerForClients(fake.NewSimpleClientset(), nil, deployment, options...)
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *args.Kubeconfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load kubeconfig from '%s'", *args.Kubeconfig)
+	}
+	return deployer.NewDeployer(config, deployment, options...)
+}
+
+// writeReports writes the run report in every format that was asked for on the command line
+func writeReports(report *deployer.Report, args parse.ClientArgs) error {
+	if report == nil {
+		return nil
+	}
+	if *args.JUnitReport != "" {
+		if err := writeReport(*args.JUnitReport, report.WriteJUnit); err != nil {
+			return err
+		}
+	}
+	if *args.JSONReport != "" {
+		if err := writeReport(*args.JSONReport, report.WriteJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeReport(filepath string, write func(io.Writer) error) error {
+	file, err := os.Create(filepath)
+	if err != nil {
+		return errors.Wrapf(err, "could not create report '%s'", filepath)
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return errors.Wrapf(err, "could not write report '%s'", filepath)
+	}
+	return errors.Wrapf(file.Close(), "could not close report '%s'", filepath)
+}
+
+// configureLogging sets up the application logger and the separate deployer and observer loggers. debug overrides the
+// levels of all of them
+func configureLogging(logFormat string, debug bool, deployerLevel, observerLevel string) error {
+	format := deployer.LogFormat(logFormat)
+	deployer.ConfigureColour(format, log.StandardLogger().Out)
+
+	loggers := []struct {
+		logger *log.Logger
+		level  string
+	}{
+		{log.StandardLogger(), "info"},
+		{deployer.DeployerLogger, deployerLevel},
+		{deployer.ObserverLogger, observerLevel},
+	}
+	for _, l := range loggers {
+		level, err := log.ParseLevel(l.level)
+		if err != nil {
+			return deployer.WithKind(deployer.ErrValidation, errors.Wrap(err, "could not parse log level"))
+		}
+		if debug {
+			level = log.DebugLevel
+		}
+		if err := deployer.ConfigureLogger(l.logger, format, level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exitCode maps the error returned by a run to the exit code of the process.
+// A rollback takes precedence, as it tells the caller that the cluster has been changed back.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, deployer.ErrRolledBack):
+		return exitRolledBack
+	case errors.Is(err, deployer.ErrInterrupted):
+		return exitInterrupted
+	case errors.Is(err, deployer.ErrValidation):
+		return exitValidationError
+	case errors.Is(err, deployer.ErrTimeout):
+		return exitTimeout
+	case errors.Is(err, deployer.ErrCluster):
+		return exitClusterError
+	default:
+		return exitSetupError
+	}
 }
 
 func getSeldonDeployment(filepath string) (*machinelearningv1.SeldonDeployment, error) {
@@ -45,6 +294,7 @@ func getSeldonDeployment(filepath string) (*machinelearningv1.SeldonDeployment,
 	if err != nil {
 		return nil, errors.Wrapf(err, "could not open '%s'", filepath)
 	}
+	defer file.Close()
 
 	rawData, err := ioutil.ReadAll(file)
 	if err != nil {
@@ -58,3 +308,248 @@ func getSeldonDeployment(filepath string) (*machinelearningv1.SeldonDeployment,
 
 	return deployment, nil
 }
+
+// predictCommand is the subcommand that sends request payloads to a model that is already deployed
+const predictCommand = "predict"
+
+// runPredict sends the request payloads of the predict subcommand to the model, and writes every response to stdout
+// as JSON Lines. Failed requests are logged and make the run fail once all payloads have been sent.
+func runPredict() error {
+	parser := parse.NewPredictParser()
+	args, err := parser.Parse(os.Args[1:])
+	if err != nil {
+		return deployer.WithKind(deployer.ErrValidation, errors.Wrap(err, "could not parse command line arguments"))
+	}
+
+	file, err := os.Open(*args.Requests)
+	if err != nil {
+		return deployer.WithKind(deployer.ErrValidation, errors.Wrapf(err, "could not open requests file '%s'", *args.Requests))
+	}
+	defer file.Close()
+	payloads, err := deployer.ReadPayloads(file)
+	if err != nil {
+		return deployer.WithKind(deployer.ErrValidation, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*args.Timeout)*time.Second)
+	defer cancel()
+	client, closeClient, err := newPredictor(ctx, args)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	failed := 0
+	for _, payload := range payloads {
+		response, err := client.PredictJSON(ctx, payload.Body)
+		if err != nil {
+			if ctx.Err() != nil {
+				return deployer.WithKind(deployer.ErrTimeout, errors.Wrap(ctx.Err(), "prediction requests did not finish in time"))
+			}
+			log.WithField("line", payload.Line).Warn(err)
+			failed++
+			continue
+		}
+		if err := writeResponse(os.Stdout, response); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return deployer.WithKind(deployer.ErrCluster, fmt.Errorf("%d of %d prediction requests failed", failed, len(payloads)))
+	}
+	return nil
+}
+
+// newPredictor returns a client for the model at the URL of args, configured by the deployment of args if one is
+// given, together with a function that closes its connection
+func newPredictor(ctx context.Context, args parse.PredictArgs) (predict.JSONPredictor, func(), error) {
+	protocol, model, useGRPC := machinelearningv1.Protocol(*args.Protocol), *args.Model, *args.GRPC
+	if *args.DeployConfig != "" {
+		deployment, err := getSeldonDeployment(*args.DeployConfig)
+		if err != nil {
+			return nil, nil, deployer.WithKind(deployer.ErrValidation, err)
+		}
+		if protocol == "" {
+			protocol = predict.ProtocolOf(deployment)
+		}
+		if model == "" {
+			model = predict.ModelName(deployment)
+		}
+		useGRPC = useGRPC || predict.UsesGRPC(deployment)
+	}
+
+	if !useGRPC {
+		client, err := predict.NewClient(&http.Client{}, *args.URL, protocol, model)
+		return client, func() {}, deployer.WithKind(deployer.ErrValidation, err)
+	}
+	target := predict.GRPCTarget(*args.URL)
+	conn, err := grpc.DialContext(ctx, target, grpc.WithInsecure())
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not dial %s", target)
+	}
+	client, err := predict.NewGRPCClient(conn, protocol, model)
+	if err != nil {
+		conn.Close()
+		return nil, nil, deployer.WithKind(deployer.ErrValidation, err)
+	}
+	return client, func() { conn.Close() }, nil
+}
+
+// writeResponse writes a response on a single line
+func writeResponse(w io.Writer, response []byte) error {
+	var line bytes.Buffer
+	if err := json.Compact(&line, response); err != nil {
+		line.Reset()
+		line.Write(bytes.TrimSpace(response))
+	}
+	line.WriteByte('\n')
+	_, err := w.Write(line.Bytes())
+	return errors.Wrap(err, "could not write response")
+}
+
+// controllerCommand is the subcommand that continuously reconciles the cluster toward a desired set of deployments
+const controllerCommand = "controller"
+
+// runController reconciles the SeldonDeployments of the cluster toward the desired manifests until the process is
+// interrupted or terminated
+func runController() error {
+	parser := parse.NewControllerParser()
+	args, err := parser.Parse(os.Args[1:])
+	if err != nil {
+		return deployer.WithKind(deployer.ErrValidation, errors.Wrap(err, "could not parse command line arguments"))
+	}
+	if err := configureLogging(*args.LogFormat, *args.Debug, "info", "info"); err != nil {
+		return err
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", *args.Kubeconfig)
+	if err != nil {
+		return errors.Wrapf(err, "could not load kubeconfig from '%s'", *args.Kubeconfig)
+	}
+	clientset, err := seldonclientset.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "could not create new Seldon ClientSet")
+	}
+	source := deployer.DirectorySource(*args.Manifests)
+	if *args.ConfigMap != "" {
+		namespace, name, err := cache.SplitMetaNamespaceKey(*args.ConfigMap)
+		if err != nil || namespace == "" {
+			return deployer.WithKind(deployer.ErrValidation, fmt.Errorf("--configmap has to be given as namespace/name"))
+		}
+		kubeClient, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return errors.Wrap(err, "could not create new Kubernetes ClientSet")
+		}
+		source = deployer.ConfigMapSource(kubeClient, namespace, name)
+	}
+
+	options := []deployer.Option{
+		deployer.WithResync(time.Duration(*args.Resync) * time.Second),
+		deployer.WithWorkers(*args.Workers),
+		deployer.WithNamespace(*args.Namespace),
+	}
+	if *args.DryRun {
+		options = append(options, deployer.WithDryRun())
+	}
+	endpointOptions, stopServing := serveEndpoints(*args.MetricsAddress, *args.HealthAddress)
+	defer stopServing()
+	options = append(options, endpointOptions...)
+
+	controller := deployer.NewController(clientset, source, options...)
+	if *args.LeaderElect {
+		return runAsLeader(args.Kubeconfig, args.LeaderElectionArgs, controller.Run)
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+	return controller.Run(ctx)
+}
+
+// serveEndpoints serves Prometheus metrics at /metrics on metricsAddress, and the liveness and readiness probes at
+// /healthz and /readyz on healthAddress, in the background until the returned function is called. Either is not served
+// if its address is empty, and both can share an address. The returned options record the served metrics and checks.
+func serveEndpoints(metricsAddress, healthAddress string) ([]deployer.Option, func()) {
+	var options []deployer.Option
+	muxes := make(map[string]*http.ServeMux)
+	handle := func(address, path string, handler http.Handler) {
+		if muxes[address] == nil {
+			muxes[address] = http.NewServeMux()
+		}
+		muxes[address].Handle(path, handler)
+		log.Infof("Serving %s on %s", path, address)
+	}
+	if metricsAddress != "" {
+		metrics := deployer.NewMetrics()
+		handle(metricsAddress, "/metrics", metrics.Handler())
+		options = append(options, deployer.WithMetrics(metrics))
+	}
+	if healthAddress != "" {
+		health := deployer.NewHealth()
+		handle(healthAddress, "/healthz", health.LivenessHandler())
+		handle(healthAddress, "/readyz", health.ReadinessHandler())
+		options = append(options, deployer.WithHealth(health))
+	}
+
+	var servers []*http.Server
+	for address, mux := range muxes {
+		server := &http.Server{Addr: address, Handler: mux}
+		servers = append(servers, server)
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.WithError(err).Errorf("could not serve on %s", server.Addr)
+			}
+		}()
+	}
+	return options, func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}
+}
+
+// flushTraces exports the spans that have not been exported yet before the process exits
+func flushTraces(shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		log.WithError(err).Warn("could not export the trace of the run")
+	}
+}
+
+// signalContext returns a context that is cancelled once the process is interrupted or terminated
+func signalContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case received := <-signals:
+			log.Infof("Received %s. Stopping...", received)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// runAsLeader calls run once this instance holds the Lease of args. On SIGINT or SIGTERM, the context of run is
+// cancelled and the Lease is released once run has returned.
+func runAsLeader(kubeconfig *string, args parse.LeaderElectionArgs, run func(context.Context) error) error {
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return errors.Wrapf(err, "could not load kubeconfig from '%s'", *kubeconfig)
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "could not create new Kubernetes ClientSet")
+	}
+	ctx, cancel := signalContext()
+	defer cancel()
+	return deployer.RunAsLeader(ctx, deployer.LeaderElection{
+		Client:    kubeClient,
+		Namespace: *args.LeaseNamespace,
+		Name:      *args.LeaseName,
+	}, run)
+}
@@ -1,6 +1,7 @@
 package parse
 
 import (
+	"fmt"
 	"github.com/akamensky/argparse"
 	"github.com/pkg/errors"
 	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
@@ -10,6 +11,8 @@ import (
 	"path/filepath"
 )
 
+var logLevels = []string{"debug", "info", "warn", "error"}
+
 type ClientParser struct {
 	parser *argparse.Parser
 	args   ClientArgs // Pointer
@@ -19,6 +22,73 @@ type ClientArgs struct {
 	Kubeconfig *string
 	DeployConfig *string
 	Debug      *bool
+	DryRun      *bool
+	Timeout     *int
+	Record      *string
+	Replay      *string
+	ReplayMode  *string
+	JUnitReport *string
+	JSONReport  *string
+	LogFormat         *string
+	DeployerLogLevel  *string
+	ObserverLogLevel  *string
+	Requests          *string
+	PredictURL        *string
+	IngressURL        *string
+	MaxErrorRate      *float64
+	Responses         *string
+	PortForward       *bool
+	Predictor         *string
+	LoadTest          *int
+	RPS               *float64
+	Concurrency       *int
+	MaxP99            *int
+	ReferenceURL      *string
+	Comparison        *string
+	Tolerance         *float64
+	MinAgreement      *float64
+	MetricsAddress    *string
+	HealthAddress     *string
+	TraceExporter     *string
+	OTLPAddress       *string
+	Plan              *string
+	LeaderElectionArgs
+}
+
+// LeaderElectionArgs are the arguments of the modes that can elect a leader among their instances
+type LeaderElectionArgs struct {
+	LeaderElect    *bool
+	LeaseName      *string
+	LeaseNamespace *string
+}
+
+func addMetricsAddress(parser *argparse.Parser) *string {
+	return parser.String("", "metrics-address", &argparse.Options{
+		Help: "address to serve Prometheus metrics on at /metrics, e.g. :8080. Not served if not given",
+	})
+}
+
+func addHealthAddress(parser *argparse.Parser) *string {
+	return parser.String("", "health-address", &argparse.Options{
+		Help: "address to serve the liveness and readiness probes on at /healthz and /readyz, e.g. :8081. May be the --metrics-address",
+	})
+}
+
+func addLeaderElectionArgs(parser *argparse.Parser) LeaderElectionArgs {
+	return LeaderElectionArgs{
+		LeaderElect: parser.Flag("", "leader-elect", &argparse.Options{
+			Default: false,
+			Help:    "only act once this instance holds a Lease, so that several instances can run for availability",
+		}),
+		LeaseName: parser.String("", "lease-name", &argparse.Options{
+			Default: "go-client-k8s",
+			Help:    "name of the Lease of the leader election",
+		}),
+		LeaseNamespace: parser.String("", "lease-namespace", &argparse.Options{
+			Default: "default",
+			Help:    "namespace of the Lease of the leader election",
+		}),
+	}
 }
 
 /*
@@ -48,6 +118,109 @@ func NewClientParser() ClientParser {
 		Default: false,
 		Help:    "debug flag. Warning: will be very spammy, only enable for debugging purposes",
 	})
+	args.DryRun = parser.Flag("", "dry-run", &argparse.Options{
+		Default: false,
+		Help:    "send every request to the cluster as a server-side dry run, so that nothing is changed",
+	})
+	args.Timeout = parser.Int("t", "timeout", &argparse.Options{
+		Default: 60,
+		Help:    "number of seconds all instructions have to finish in",
+	})
+	args.Record = parser.String("", "record", &argparse.Options{
+		Help: "file path to record every observed event to as JSON Lines, e.g. events.jsonl",
+	})
+	args.Replay = parser.String("", "replay", &argparse.Options{
+		Help: "file path of a recording to replay instead of observing the cluster. Requests are sent to a fake cluster",
+	})
+	args.ReplayMode = parser.Selector("", "replay-mode", []string{"realtime", "fast"}, &argparse.Options{
+		Default: "fast",
+		Help:    "replay events with the time that passed between them when recorded, or as fast as possible",
+	})
+	args.LogFormat = parser.Selector("", "log-format", []string{"text", "json"}, &argparse.Options{
+		Default: "text",
+		Help:    "format of the logs. Colours are disabled for json, when not logging to a terminal or when NO_COLOR is set",
+	})
+	args.DeployerLogLevel = parser.Selector("", "deployer-log-level", logLevels, &argparse.Options{
+		Default: "info",
+		Help:    "log level of the deployer. Overridden by --debug",
+	})
+	args.ObserverLogLevel = parser.Selector("", "observer-log-level", logLevels, &argparse.Options{
+		Default: "info",
+		Help:    "log level of the observer. Overridden by --debug",
+	})
+	args.JUnitReport = parser.String("", "report", &argparse.Options{
+		Help: "file path to write a JUnit XML report of the instructions to, e.g. junit.xml",
+	})
+	args.JSONReport = parser.String("", "report-json", &argparse.Options{
+		Help: "file path to write a JSON report of the instructions to, e.g. report.json",
+	})
+	args.Requests = parser.String("", "requests", &argparse.Options{
+		Help: "file path of JSON Lines request payloads to send to the model once it is scaled, e.g. requests.jsonl",
+	})
+	args.PredictURL = parser.String("", "predict-url", &argparse.Options{
+		Help: "base URL of the model's REST API, e.g. http://localhost:8000",
+	})
+	args.IngressURL = parser.String("", "ingress-url", &argparse.Options{
+		Help: "URL of the Seldon ingress, used to reach the model's REST API if --predict-url is not given",
+	})
+	args.MaxErrorRate = parser.Float("", "max-error-rate", &argparse.Options{
+		Default: 0.0,
+		Help:    "highest fraction of prediction requests that may fail, between 0 and 1",
+	})
+	args.Responses = parser.String("", "responses", &argparse.Options{
+		Help: "file path to write the result of every prediction request to as JSON Lines, e.g. responses.jsonl",
+	})
+	args.PortForward = parser.Flag("", "port-forward", &argparse.Options{
+		Default: false,
+		Help:    "send prediction requests through a port-forward to a ready pod of the predictor, e.g. on minikube",
+	})
+	args.Predictor = parser.String("", "predictor", &argparse.Options{
+		Help: "name of the predictor to port-forward to. Defaults to the first predictor of the deployment",
+	})
+	args.LoadTest = parser.Int("", "load-test", &argparse.Options{
+		Default: 0,
+		Help:    "number of seconds to load test the model for with the --requests payloads, after they have been sent once. Has to be less than --timeout, which it is part of. Not supported for models served over gRPC",
+	})
+	args.RPS = parser.Float("", "rps", &argparse.Options{
+		Default: 0.0,
+		Help:    "target number of requests per second of the load test. As many as possible if not given",
+	})
+	args.Concurrency = parser.Int("", "concurrency", &argparse.Options{
+		Default: 1,
+		Help:    "number of requests the load test sends at the same time",
+	})
+	args.MaxP99 = parser.Int("", "max-p99", &argparse.Options{
+		Default: 0,
+		Help:    "highest p99 latency of the load test in milliseconds. Not checked if not given",
+	})
+	args.ReferenceURL = parser.String("", "reference-url", &argparse.Options{
+		Help: "base URL of the REST API of a reference predictor, e.g. the model being replaced, to compare the --requests predictions with",
+	})
+	args.Comparison = parser.Selector("", "comparison", []string{"tolerance", "argmax"}, &argparse.Options{
+		Default: "tolerance",
+		Help:    "compare the predictions value by value within --tolerance, or by the argmax of every row",
+	})
+	args.Tolerance = parser.Float("", "tolerance", &argparse.Options{
+		Default: 0.0,
+		Help:    "largest difference between two prediction values that are equal",
+	})
+	args.MinAgreement = parser.Float("", "min-agreement", &argparse.Options{
+		Default: 1.0,
+		Help:    "lowest fraction of the requests the model and the reference predictor have to agree on, between 0 and 1",
+	})
+	args.MetricsAddress = addMetricsAddress(parser)
+	args.HealthAddress = addHealthAddress(parser)
+	args.TraceExporter = parser.Selector("", "trace-exporter", []string{"none", "stdout", "otlp"}, &argparse.Options{
+		Default: "none",
+		Help:    "where to export the OpenTelemetry trace of the run to. Not traced by default",
+	})
+	args.OTLPAddress = parser.String("", "otlp-address", &argparse.Options{
+		Help: "address of the OpenTelemetry collector the otlp trace exporter sends spans to. Defaults to localhost:55680",
+	})
+	args.Plan = parser.String("", "plan", &argparse.Options{
+		Help: "file path to a yaml/json plan of the instructions to run, instead of the default create, scale and delete",
+	})
+	args.LeaderElectionArgs = addLeaderElectionArgs(parser)
 
 	return ClientParser{
 		parser: parser,
@@ -60,6 +233,161 @@ func (c *ClientParser) Parse(args []string) (ClientArgs, error) {
 	if err != nil {
 		return ClientArgs{}, err
 	}
+	// The load test runs within the timeout of the run, so it would always time out otherwise
+	if *c.args.LoadTest > 0 && *c.args.LoadTest >= *c.args.Timeout {
+		return ClientArgs{}, fmt.Errorf("--load-test has to be less than --timeout, as the load test is part of the run")
+	}
+	return c.args, nil
+}
+
+type PredictParser struct {
+	parser *argparse.Parser
+	args   PredictArgs
+}
+
+type PredictArgs struct {
+	URL          *string
+	Requests     *string
+	DeployConfig *string
+	Protocol     *string
+	Model        *string
+	GRPC         *bool
+	Timeout      *int
+}
+
+/*
+Parser of the predict subcommand, which sends request payloads to a model that is already deployed
+*/
+func NewPredictParser() PredictParser {
+	parser := argparse.NewParser("Go k8s client predict", "Sends JSON Lines request payloads to a model and prints its responses")
+
+	args := PredictArgs{}
+
+	args.URL = parser.String("u", "url", &argparse.Options{
+		Required: true,
+		Help:     "base URL of the model's REST API, or the address of its gRPC API, e.g. http://localhost:8000",
+	})
+	args.Requests = parser.String("r", "requests", &argparse.Options{
+		Required: true,
+		Help:     "file path of JSON Lines request payloads written in the protocol's JSON, e.g. requests.jsonl",
+	})
+	args.DeployConfig = parser.String("c", "config", &argparse.Options{
+		Help: "file path to the deployment yaml/json file to take the protocol, transport and model name from",
+	})
+	args.Protocol = parser.Selector("p", "protocol", []string{"seldon", "tensorflow", "kfserving"}, &argparse.Options{
+		Help: "protocol the model is served with. Overrides --config, seldon if neither is given",
+	})
+	args.Model = parser.String("m", "model", &argparse.Options{
+		Help: "name of the model in the paths of the tensorflow and kfserving protocols. Overrides --config",
+	})
+	args.GRPC = parser.Flag("", "grpc", &argparse.Options{
+		Default: false,
+		Help:    "send the requests over gRPC, which is also used if the --config deployment is served over gRPC",
+	})
+	args.Timeout = parser.Int("t", "timeout", &argparse.Options{
+		Default: 60,
+		Help:    "number of seconds all requests have to finish in",
+	})
+
+	return PredictParser{
+		parser: parser,
+		args:   args,
+	}
+}
+
+func (p *PredictParser) Parse(args []string) (PredictArgs, error) {
+	err := p.parser.Parse(args)
+	if err != nil {
+		return PredictArgs{}, err
+	}
+	return p.args, nil
+}
+
+type ControllerParser struct {
+	parser *argparse.Parser
+	args   ControllerArgs
+}
+
+type ControllerArgs struct {
+	Kubeconfig     *string
+	Manifests      *string
+	ConfigMap      *string
+	Namespace      *string
+	Resync         *int
+	Workers        *int
+	DryRun         *bool
+	Debug          *bool
+	LogFormat      *string
+	MetricsAddress *string
+	HealthAddress  *string
+	LeaderElectionArgs
+}
+
+/*
+Parser of the controller subcommand, which continuously reconciles the cluster toward a desired set of deployments
+*/
+func NewControllerParser() ControllerParser {
+	parser := argparse.NewParser("Go k8s client controller", "Reconciles SeldonDeployments toward a directory or ConfigMap of manifests")
+
+	args := ControllerArgs{}
+
+	kubeConfigArgOptions := &argparse.Options{
+		Help: "absolute path to kubeconfig file",
+	}
+	if home := homedir.HomeDir(); home != "" {
+		kubeConfigArgOptions.Default = filepath.Join(home, ".kube", "config")
+	} else {
+		kubeConfigArgOptions.Required = true
+	}
+
+	args.Kubeconfig = parser.String("k", "kubeconfig", kubeConfigArgOptions)
+	args.Manifests = parser.String("m", "manifests", &argparse.Options{
+		Help: "directory of the desired SeldonDeployment yaml/json manifests",
+	})
+	args.ConfigMap = parser.String("", "configmap", &argparse.Options{
+		Help: "namespace/name of a ConfigMap with the desired SeldonDeployment manifests, used instead of --manifests",
+	})
+	args.Namespace = parser.String("n", "namespace", &argparse.Options{
+		Help: "namespace to reconcile every desired SeldonDeployment in, instead of the namespace of its manifest",
+	})
+	args.Resync = parser.Int("", "resync", &argparse.Options{
+		Default: 30,
+		Help:    "number of seconds between reading the desired manifests again",
+	})
+	args.Workers = parser.Int("", "workers", &argparse.Options{
+		Default: 1,
+		Help:    "number of SeldonDeployments reconciled at the same time",
+	})
+	args.DryRun = parser.Flag("", "dry-run", &argparse.Options{
+		Default: false,
+		Help:    "send every request to the cluster as a server-side dry run, so that nothing is changed",
+	})
+	args.Debug = parser.Flag("d", "debug", &argparse.Options{
+		Default: false,
+		Help:    "debug flag. Warning: will be very spammy, only enable for debugging purposes",
+	})
+	args.LogFormat = parser.Selector("", "log-format", []string{"text", "json"}, &argparse.Options{
+		Default: "text",
+		Help:    "format of the logs. Colours are disabled for json, when not logging to a terminal or when NO_COLOR is set",
+	})
+	args.MetricsAddress = addMetricsAddress(parser)
+	args.HealthAddress = addHealthAddress(parser)
+	args.LeaderElectionArgs = addLeaderElectionArgs(parser)
+
+	return ControllerParser{
+		parser: parser,
+		args:   args,
+	}
+}
+
+func (c *ControllerParser) Parse(args []string) (ControllerArgs, error) {
+	err := c.parser.Parse(args)
+	if err != nil {
+		return ControllerArgs{}, err
+	}
+	if (*c.args.Manifests == "") == (*c.args.ConfigMap == "") {
+		return ControllerArgs{}, fmt.Errorf("exactly one of --manifests and --configmap has to be given")
+	}
 	return c.args, nil
 }
 
@@ -75,6 +403,11 @@ func convertToJsonBytes(rawData []byte) (rawJsonData []byte, err error) {
 	return rawJsonData, nil
 }
 
+// ToJSON converts yaml or json, e.g. of a plan file, to json, so that it can be unmarshalled into structs with json tags
+func ToJSON(rawData []byte) ([]byte, error) {
+	return convertToJsonBytes(rawData)
+}
+
 func UnmarshalSeldonDeployment(rawData []byte) (*machinelearningv1.SeldonDeployment, error) {
 	rawJsonData, err := convertToJsonBytes(rawData)
 	if err != nil {
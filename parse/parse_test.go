@@ -112,3 +112,49 @@ spec:
 		assertValues(deployment)
 	})
 }
+
+func TestNewClientParser(t *testing.T) {
+	parser := NewClientParser()
+	args, err := parser.Parse([]string{"go-client-k8s", "--requests", "requests.jsonl", "--load-test", "30"})
+	checkErrWithStackTrace(t, err)
+	assert.Equal(t, 30, *args.LoadTest)
+	assert.Equal(t, 60, *args.Timeout)
+
+	parser = NewClientParser()
+	_, err = parser.Parse([]string{"go-client-k8s", "--requests", "requests.jsonl", "--load-test", "60"})
+	assert.EqualError(t, err, "--load-test has to be less than --timeout, as the load test is part of the run")
+}
+
+func TestNewPredictParser(t *testing.T) {
+	parser := NewPredictParser()
+	args, err := parser.Parse([]string{"predict", "--url", "localhost:5001", "-r", "requests.jsonl", "--protocol", "kfserving", "--grpc"})
+	checkErrWithStackTrace(t, err)
+	assert.Equal(t, "localhost:5001", *args.URL)
+	assert.Equal(t, "requests.jsonl", *args.Requests)
+	assert.Equal(t, "kfserving", *args.Protocol)
+	assert.True(t, *args.GRPC)
+	assert.Equal(t, 60, *args.Timeout)
+
+	parser = NewPredictParser()
+	_, err = parser.Parse([]string{"predict", "--url", "localhost:5001"})
+	assert.Error(t, err)
+}
+
+func TestNewControllerParser(t *testing.T) {
+	parser := NewControllerParser()
+	args, err := parser.Parse([]string{"controller", "--manifests", "./deployments", "--workers", "2"})
+	checkErrWithStackTrace(t, err)
+	assert.Equal(t, "./deployments", *args.Manifests)
+	assert.Equal(t, 2, *args.Workers)
+	assert.Equal(t, 30, *args.Resync)
+	assert.Equal(t, "text", *args.LogFormat)
+
+	parser = NewControllerParser()
+	args, err = parser.Parse([]string{"controller", "--configmap", "seldon/desired", "--log-format", "json"})
+	checkErrWithStackTrace(t, err)
+	assert.Equal(t, "json", *args.LogFormat)
+
+	parser = NewControllerParser()
+	_, err = parser.Parse([]string{"controller", "--manifests", "./deployments", "--configmap", "seldon/desired"})
+	assert.EqualError(t, err, "exactly one of --manifests and --configmap has to be given")
+}
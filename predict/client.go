@@ -0,0 +1,89 @@
+package predict
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// JSONPredictor sends prediction requests written in JSON, and returns the responses as JSON
+type JSONPredictor interface {
+	PredictJSON(ctx context.Context, request []byte) ([]byte, error)
+}
+
+// Client sends prediction requests to the REST API of a model with the protocol it is served with
+type Client struct {
+	httpClient *http.Client
+	codec      Codec
+	url        string
+}
+
+// NewClient returns a Client for model, which is served with protocol at baseURL
+func NewClient(httpClient *http.Client, baseURL string, protocol machinelearningv1.Protocol, model string) (*Client, error) {
+	codec, err := CodecFor(protocol)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		httpClient: httpClient,
+		codec:      codec,
+		url:        strings.TrimSuffix(baseURL, "/") + codec.Path(model),
+	}, nil
+}
+
+// URL returns the URL of the prediction endpoint
+func (c *Client) URL() string {
+	return c.url
+}
+
+// Predict sends the request to the model and returns its response
+func (c *Client) Predict(ctx context.Context, request Payload) (Payload, error) {
+	body, err := c.codec.EncodeRequest(request)
+	if err != nil {
+		return Payload{}, errors.Wrap(err, "could not encode request")
+	}
+	body, err = c.PredictJSON(ctx, body)
+	if err != nil {
+		return Payload{}, err
+	}
+	return c.codec.DecodeResponse(body)
+}
+
+// PredictJSON sends a request that is already written in the protocol's JSON, and returns the response as is
+func (c *Client) PredictJSON(ctx context.Context, request []byte) ([]byte, error) {
+	_, body, err := PostJSON(ctx, c.httpClient, c.url, request)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// PostJSON posts a JSON request to url. The status code and the body of the response are returned also if the
+// response has an error status, for callers that record them.
+func PostJSON(ctx context.Context, httpClient *http.Client, url string, request []byte) (int, []byte, error) {
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(request))
+	if err != nil {
+		return 0, nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpResponse, err := httpClient.Do(httpRequest)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "could not send prediction request")
+	}
+	defer httpResponse.Body.Close()
+
+	body, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return httpResponse.StatusCode, nil, errors.Wrap(err, "could not read response")
+	}
+	if httpResponse.StatusCode >= http.StatusBadRequest {
+		return httpResponse.StatusCode, body, fmt.Errorf("prediction failed with status %s: %s", httpResponse.Status,
+			bytes.TrimSpace(body))
+	}
+	return httpResponse.StatusCode, body, nil
+}
@@ -0,0 +1,465 @@
+package predict
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/structpb" // Registers google/protobuf/struct.proto, which Seldon's messages use
+	"math"
+	"net/url"
+	"strings"
+)
+
+// Methods of the gRPC APIs of the Seldon and V2 protocols
+const (
+	SeldonPredictMethod = "/seldon.protos.Seldon/Predict"
+	V2ModelInferMethod  = "/inference.GRPCInferenceService/ModelInfer"
+)
+
+// The messages of Seldon's prediction.proto and of the V2 protocol's grpc_predict_v2.proto that are needed for
+// predictions, as the generated Go code of either cannot be depended on. Field numbers match the original files.
+const seldonProto = `
+name: "seldon/prediction.proto" package: "seldon.protos" syntax: "proto3"
+dependency: "google/protobuf/struct.proto"
+message_type {
+  name: "SeldonMessage"
+  field { name: "status" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".seldon.protos.Status" }
+  field { name: "meta" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".seldon.protos.Meta" }
+  field { name: "data" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".seldon.protos.DefaultData" oneof_index: 0 }
+  field { name: "binData" number: 4 label: LABEL_OPTIONAL type: TYPE_BYTES oneof_index: 0 }
+  field { name: "strData" number: 5 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+  field { name: "jsonData" number: 6 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Value" oneof_index: 0 }
+  oneof_decl { name: "data_oneof" }
+}
+message_type {
+  name: "DefaultData"
+  field { name: "names" number: 1 label: LABEL_REPEATED type: TYPE_STRING }
+  field { name: "tensor" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".seldon.protos.Tensor" oneof_index: 0 }
+  field { name: "ndarray" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.ListValue" oneof_index: 0 }
+  oneof_decl { name: "data_oneof" }
+}
+message_type {
+  name: "Tensor"
+  field { name: "shape" number: 1 label: LABEL_REPEATED type: TYPE_INT32 }
+  field { name: "values" number: 2 label: LABEL_REPEATED type: TYPE_DOUBLE }
+}
+message_type {
+  name: "Meta"
+  field { name: "puid" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+}
+message_type {
+  name: "Status"
+  field { name: "code" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 }
+  field { name: "info" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "reason" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "status" number: 4 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".seldon.protos.Status.StatusFlag" }
+  enum_type { name: "StatusFlag" value { name: "SUCCESS" number: 0 } value { name: "FAILURE" number: 1 } }
+}
+`
+
+const v2Proto = `
+name: "inference/grpc_predict_v2.proto" package: "inference" syntax: "proto3"
+message_type {
+  name: "ModelInferRequest"
+  field { name: "model_name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "model_version" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "id" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "inputs" number: 5 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".inference.ModelInferRequest.InferInputTensor" }
+  field { name: "raw_input_contents" number: 7 label: LABEL_REPEATED type: TYPE_BYTES }
+  nested_type {
+    name: "InferInputTensor"
+    field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "datatype" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "shape" number: 3 label: LABEL_REPEATED type: TYPE_INT64 }
+    field { name: "contents" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".inference.InferTensorContents" }
+  }
+}
+message_type {
+  name: "ModelInferResponse"
+  field { name: "model_name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "model_version" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "id" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING }
+  field { name: "outputs" number: 5 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".inference.ModelInferResponse.InferOutputTensor" }
+  field { name: "raw_output_contents" number: 6 label: LABEL_REPEATED type: TYPE_BYTES }
+  nested_type {
+    name: "InferOutputTensor"
+    field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "datatype" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING }
+    field { name: "shape" number: 3 label: LABEL_REPEATED type: TYPE_INT64 }
+    field { name: "contents" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".inference.InferTensorContents" }
+  }
+}
+message_type {
+  name: "InferTensorContents"
+  field { name: "bool_contents" number: 1 label: LABEL_REPEATED type: TYPE_BOOL }
+  field { name: "int_contents" number: 2 label: LABEL_REPEATED type: TYPE_INT32 }
+  field { name: "int64_contents" number: 3 label: LABEL_REPEATED type: TYPE_INT64 }
+  field { name: "uint_contents" number: 4 label: LABEL_REPEATED type: TYPE_UINT32 }
+  field { name: "uint64_contents" number: 5 label: LABEL_REPEATED type: TYPE_UINT64 }
+  field { name: "fp32_contents" number: 6 label: LABEL_REPEATED type: TYPE_FLOAT }
+  field { name: "fp64_contents" number: 7 label: LABEL_REPEATED type: TYPE_DOUBLE }
+  field { name: "bytes_contents" number: 8 label: LABEL_REPEATED type: TYPE_BYTES }
+}
+`
+
+// Descriptors of the request and response messages of the gRPC APIs
+var (
+	SeldonMessage      = mustMessage(seldonProto, "seldon.protos.SeldonMessage")
+	ModelInferRequest  = mustMessage(v2Proto, "inference.ModelInferRequest")
+	ModelInferResponse = mustMessage(v2Proto, "inference.ModelInferResponse")
+)
+
+func mustMessage(fileProto, name string) protoreflect.MessageDescriptor {
+	fileDescriptorProto := &descriptorpb.FileDescriptorProto{}
+	if err := prototext.Unmarshal([]byte(fileProto), fileDescriptorProto); err != nil {
+		panic(err)
+	}
+	file, err := protodesc.NewFile(fileDescriptorProto, protoregistry.GlobalFiles)
+	if err != nil {
+		panic(err)
+	}
+	descriptor := file.Messages().ByName(protoreflect.FullName(name).Name())
+	if descriptor == nil {
+		panic(fmt.Sprintf("message %s is not defined", name))
+	}
+	return descriptor
+}
+
+// UsesGRPC returns whether the deployment serves its model over gRPC instead of REST
+func UsesGRPC(deployment *machinelearningv1.SeldonDeployment) bool {
+	if deployment.Spec.Transport == machinelearningv1.TransportGrpc {
+		return true
+	}
+	if len(deployment.Spec.Predictors) == 0 {
+		return false
+	}
+	endpoint := deployment.Spec.Predictors[0].Graph.Endpoint
+	return endpoint != nil && endpoint.Type == machinelearningv1.GRPC
+}
+
+// GRPCTarget returns the address to dial for the gRPC API at address, which may be given as a URL, e.g. the same base
+// URL as the model's REST API
+func GRPCTarget(address string) string {
+	if !strings.Contains(address, "://") {
+		return strings.TrimSuffix(address, "/")
+	}
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return address
+	}
+	return parsed.Host
+}
+
+// IngressMetadata returns the gRPC metadata the Seldon ingress routes requests to a deployment by
+func IngressMetadata(namespace, name string) metadata.MD {
+	return metadata.Pairs("seldon", name, "namespace", namespace)
+}
+
+// GRPCClient sends prediction requests to the gRPC API of a model with the protocol it is served with
+type GRPCClient struct {
+	conn     grpc.ClientConnInterface
+	protocol machinelearningv1.Protocol
+	model    string
+}
+
+// NewGRPCClient returns a GRPCClient for model, which is served with protocol on conn. Only the Seldon and V2
+// protocols have a gRPC API.
+func NewGRPCClient(conn grpc.ClientConnInterface, protocol machinelearningv1.Protocol, model string) (*GRPCClient, error) {
+	switch protocol {
+	case "":
+		protocol = Seldon
+	case Seldon, V2:
+	default:
+		return nil, fmt.Errorf("protocol '%s' is not supported over gRPC", protocol)
+	}
+	return &GRPCClient{conn: conn, protocol: protocol, model: model}, nil
+}
+
+// Method returns the full name of the gRPC method predictions are sent to
+func (c *GRPCClient) Method() string {
+	if c.protocol == V2 {
+		return V2ModelInferMethod
+	}
+	return SeldonPredictMethod
+}
+
+func (c *GRPCClient) messages() (request, response *dynamicpb.Message) {
+	if c.protocol == V2 {
+		return dynamicpb.NewMessage(ModelInferRequest), dynamicpb.NewMessage(ModelInferResponse)
+	}
+	return dynamicpb.NewMessage(SeldonMessage), dynamicpb.NewMessage(SeldonMessage)
+}
+
+// PredictJSON sends a request written in the JSON mapping of the protocol's request message, and returns the response
+// in the JSON mapping of its response message. For the Seldon protocol, these are the same as its REST API's.
+func (c *GRPCClient) PredictJSON(ctx context.Context, request []byte) ([]byte, error) {
+	requestMessage, responseMessage := c.messages()
+	if err := protojson.Unmarshal(request, requestMessage); err != nil {
+		return nil, errors.Wrap(err, "could not parse request")
+	}
+	if c.protocol == V2 && !requestMessage.Has(field(requestMessage, "model_name")) {
+		requestMessage.Set(field(requestMessage, "model_name"), protoreflect.ValueOfString(c.model))
+	}
+	if err := c.conn.Invoke(ctx, c.Method(), requestMessage, responseMessage); err != nil {
+		return nil, errors.Wrap(err, "prediction failed")
+	}
+	return protojson.Marshal(responseMessage)
+}
+
+// Predict sends the request to the model and returns its response
+func (c *GRPCClient) Predict(ctx context.Context, request Payload) (Payload, error) {
+	if c.protocol == Seldon {
+		body, err := seldonCodec{}.EncodeRequest(request)
+		if err != nil {
+			return Payload{}, errors.Wrap(err, "could not encode request")
+		}
+		body, err = c.PredictJSON(ctx, body)
+		if err != nil {
+			return Payload{}, err
+		}
+		return seldonCodec{}.DecodeResponse(body)
+	}
+
+	requestMessage, responseMessage := c.messages()
+	if err := encodeV2Request(requestMessage, c.model, request); err != nil {
+		return Payload{}, errors.Wrap(err, "could not encode request")
+	}
+	if err := c.conn.Invoke(ctx, c.Method(), requestMessage, responseMessage); err != nil {
+		return Payload{}, errors.Wrap(err, "prediction failed")
+	}
+	return decodeV2Response(responseMessage)
+}
+
+func field(message protoreflect.Message, name string) protoreflect.FieldDescriptor {
+	return message.Descriptor().Fields().ByName(protoreflect.Name(name))
+}
+
+// v2ContentsFields are the fields of InferTensorContents that hold the values of each V2 datatype
+var v2ContentsFields = map[string]string{
+	"BOOL":        "bool_contents",
+	"INT8":        "int_contents",
+	"INT16":       "int_contents",
+	"INT32":       "int_contents",
+	"INT64":       "int64_contents",
+	"UINT8":       "uint_contents",
+	"UINT16":      "uint_contents",
+	"UINT32":      "uint_contents",
+	"UINT64":      "uint64_contents",
+	"FP32":        "fp32_contents",
+	"FP64":        "fp64_contents",
+	BytesDatatype: "bytes_contents",
+}
+
+func encodeV2Request(request protoreflect.Message, model string, payload Payload) error {
+	request.Set(field(request, "model_name"), protoreflect.ValueOfString(model))
+	inputs := request.Mutable(field(request, "inputs")).List()
+	if payload.Format == Binary {
+		input := inputs.NewElement().Message()
+		input.Set(field(input, "name"), protoreflect.ValueOfString("input-0"))
+		input.Set(field(input, "datatype"), protoreflect.ValueOfString(BytesDatatype))
+		input.Mutable(field(input, "shape")).List().Append(protoreflect.ValueOfInt64(1))
+		contents := input.Mutable(field(input, "contents")).Message()
+		contents.Mutable(field(contents, "bytes_contents")).List().Append(protoreflect.ValueOfBytes(payload.Binary))
+		inputs.Append(protoreflect.ValueOfMessage(input))
+		return nil
+	}
+	if len(payload.Tensors) == 0 {
+		return fmt.Errorf("the v2 protocol needs at least one input tensor")
+	}
+	for i, tensor := range payload.Tensors {
+		if err := tensor.validate(); err != nil {
+			return err
+		}
+		input := inputs.NewElement().Message()
+		name, datatype := tensor.Name, tensor.Datatype
+		if name == "" {
+			name = fmt.Sprintf("input-%d", i)
+		}
+		if datatype == "" {
+			datatype = DefaultDatatype
+		}
+		contentsField, ok := v2ContentsFields[datatype]
+		if !ok || datatype == BytesDatatype {
+			return fmt.Errorf("datatype %s of input '%s' is not supported", datatype, name)
+		}
+		input.Set(field(input, "name"), protoreflect.ValueOfString(name))
+		input.Set(field(input, "datatype"), protoreflect.ValueOfString(datatype))
+		shape := input.Mutable(field(input, "shape")).List()
+		for _, dimension := range tensor.Shape {
+			shape.Append(protoreflect.ValueOfInt64(int64(dimension)))
+		}
+		contents := input.Mutable(field(input, "contents")).Message()
+		values := contents.Mutable(field(contents, contentsField)).List()
+		for _, value := range tensor.Values {
+			values.Append(toProtoValue(field(contents, contentsField).Kind(), value))
+		}
+		inputs.Append(protoreflect.ValueOfMessage(input))
+	}
+	return nil
+}
+
+func toProtoValue(kind protoreflect.Kind, value float64) protoreflect.Value {
+	switch kind {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(value != 0)
+	case protoreflect.Int32Kind:
+		return protoreflect.ValueOfInt32(int32(value))
+	case protoreflect.Int64Kind:
+		return protoreflect.ValueOfInt64(int64(value))
+	case protoreflect.Uint32Kind:
+		return protoreflect.ValueOfUint32(uint32(value))
+	case protoreflect.Uint64Kind:
+		return protoreflect.ValueOfUint64(uint64(value))
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(value))
+	}
+	return protoreflect.ValueOfFloat64(value)
+}
+
+func fromProtoValue(value protoreflect.Value) float64 {
+	switch value := value.Interface().(type) {
+	case bool:
+		if value {
+			return 1
+		}
+		return 0
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case uint32:
+		return float64(value)
+	case uint64:
+		return float64(value)
+	case float32:
+		return float64(value)
+	case float64:
+		return value
+	}
+	return math.NaN()
+}
+
+func decodeV2Response(response protoreflect.Message) (Payload, error) {
+	outputs := response.Get(field(response, "outputs")).List()
+	rawContents := response.Get(field(response, "raw_output_contents")).List()
+	if outputs.Len() == 0 {
+		return Payload{}, fmt.Errorf("v2 response has no outputs")
+	}
+	if first := outputs.Get(0).Message(); first.Get(field(first, "datatype")).String() == BytesDatatype {
+		var raw []byte
+		if rawContents.Len() > 0 {
+			raw = rawContents.Get(0).Bytes()
+		}
+		return decodeV2GRPCBytes(first, raw)
+	}
+	payload := Payload{Format: Tensor}
+	for i := 0; i < outputs.Len(); i++ {
+		output := outputs.Get(i).Message()
+		tensor := TensorData{
+			Name:     output.Get(field(output, "name")).String(),
+			Datatype: output.Get(field(output, "datatype")).String(),
+		}
+		shape := output.Get(field(output, "shape")).List()
+		for j := 0; j < shape.Len(); j++ {
+			tensor.Shape = append(tensor.Shape, int(shape.Get(j).Int()))
+		}
+		var raw []byte
+		if i < rawContents.Len() {
+			raw = rawContents.Get(i).Bytes()
+		}
+		if raw != nil {
+			values, err := decodeRaw(tensor.Datatype, raw)
+			if err != nil {
+				return Payload{}, errors.Wrapf(err, "could not decode raw contents of output '%s'", tensor.Name)
+			}
+			tensor.Values = values
+		} else {
+			contentsField, ok := v2ContentsFields[tensor.Datatype]
+			if !ok || tensor.Datatype == BytesDatatype {
+				return Payload{}, fmt.Errorf("datatype %s of output '%s' is not supported", tensor.Datatype, tensor.Name)
+			}
+			contents := output.Get(field(output, "contents")).Message()
+			values := contents.Get(field(contents, contentsField)).List()
+			for j := 0; j < values.Len(); j++ {
+				tensor.Values = append(tensor.Values, fromProtoValue(values.Get(j)))
+			}
+		}
+		if err := tensor.validate(); err != nil {
+			return Payload{}, err
+		}
+		payload.Tensors = append(payload.Tensors, tensor)
+	}
+	return payload, nil
+}
+
+// decodeV2GRPCBytes returns the first element of a BYTES output as a binary payload. Raw BYTES contents have a
+// 4 byte little endian length before every element.
+func decodeV2GRPCBytes(output protoreflect.Message, raw []byte) (Payload, error) {
+	if raw != nil {
+		if len(raw) < 4 || len(raw) < 4+int(binary.LittleEndian.Uint32(raw)) {
+			return Payload{}, fmt.Errorf("raw contents of BYTES output are too short")
+		}
+		return NewBinary(raw[4 : 4+binary.LittleEndian.Uint32(raw)]), nil
+	}
+	contents := output.Get(field(output, "contents")).Message()
+	values := contents.Get(field(contents, "bytes_contents")).List()
+	if values.Len() == 0 {
+		return Payload{}, fmt.Errorf("BYTES output has no contents")
+	}
+	return NewBinary(values.Get(0).Bytes()), nil
+}
+
+// decodeRaw decodes little endian raw contents of a numeric V2 datatype
+func decodeRaw(datatype string, raw []byte) ([]float64, error) {
+	sizes := map[string]int{
+		"BOOL": 1, "INT8": 1, "UINT8": 1, "INT16": 2, "UINT16": 2,
+		"INT32": 4, "UINT32": 4, "FP32": 4, "INT64": 8, "UINT64": 8, "FP64": 8,
+	}
+	size, ok := sizes[datatype]
+	if !ok {
+		return nil, fmt.Errorf("datatype %s is not supported", datatype)
+	}
+	if len(raw)%size != 0 {
+		return nil, fmt.Errorf("%d bytes are not a whole number of %s values", len(raw), datatype)
+	}
+	values := make([]float64, 0, len(raw)/size)
+	for i := 0; i < len(raw); i += size {
+		element := raw[i : i+size]
+		var value float64
+		switch datatype {
+		case "BOOL", "UINT8":
+			value = float64(element[0])
+		case "INT8":
+			value = float64(int8(element[0]))
+		case "INT16":
+			value = float64(int16(binary.LittleEndian.Uint16(element)))
+		case "UINT16":
+			value = float64(binary.LittleEndian.Uint16(element))
+		case "INT32":
+			value = float64(int32(binary.LittleEndian.Uint32(element)))
+		case "UINT32":
+			value = float64(binary.LittleEndian.Uint32(element))
+		case "FP32":
+			value = float64(math.Float32frombits(binary.LittleEndian.Uint32(element)))
+		case "INT64":
+			value = float64(int64(binary.LittleEndian.Uint64(element)))
+		case "UINT64":
+			value = float64(binary.LittleEndian.Uint64(element))
+		case "FP64":
+			value = math.Float64frombits(binary.LittleEndian.Uint64(element))
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
@@ -0,0 +1,150 @@
+package predict
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"math"
+	"net"
+	"testing"
+)
+
+// newGRPCServer starts an in-process gRPC server that serves the method of a service with handle, and returns a
+// connection to it
+func newGRPCServer(t *testing.T, service, method string, request protoreflect.MessageDescriptor,
+	handle func(ctx context.Context, request *dynamicpb.Message) (interface{}, error)) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: service,
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: method,
+			Handler: func(_ interface{}, ctx context.Context, decode func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				message := dynamicpb.NewMessage(request)
+				if err := decode(message); err != nil {
+					return nil, err
+				}
+				return handle(ctx, message)
+			},
+		}},
+	}, struct{}{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.Dial() }))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func jsonMessage(t *testing.T, descriptor protoreflect.MessageDescriptor, json string) *dynamicpb.Message {
+	message := dynamicpb.NewMessage(descriptor)
+	require.NoError(t, protojson.Unmarshal([]byte(json), message))
+	return message
+}
+
+func TestGRPCTarget(t *testing.T) {
+	assert.Equal(t, "localhost:5001", GRPCTarget("http://localhost:5001/"))
+	assert.Equal(t, "localhost:5001", GRPCTarget("localhost:5001"))
+	assert.Equal(t, "ingress.example.com:443", GRPCTarget("https://ingress.example.com:443/seldon"))
+}
+
+func TestGRPCClient_Seldon(t *testing.T) {
+	var received string
+	var routedTo []string
+	conn := newGRPCServer(t, "seldon.protos.Seldon", "Predict", SeldonMessage, func(ctx context.Context, request *dynamicpb.Message) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		routedTo = md.Get("seldon")
+		body, err := protojson.Marshal(request)
+		require.NoError(t, err)
+		received = string(body)
+		if request.Has(SeldonMessage.Fields().ByName("strData")) {
+			return nil, status.Error(codes.InvalidArgument, "strData is not supported")
+		}
+		return jsonMessage(t, SeldonMessage, `{"meta":{"puid":"abc"},"data":{"names":["a","b"],"ndarray":[[0.1,0.9]]}}`), nil
+	})
+	client, err := NewGRPCClient(conn, "", "classifier")
+	require.NoError(t, err)
+	assert.Equal(t, "/seldon.protos.Seldon/Predict", client.Method())
+
+	ctx := metadata.NewOutgoingContext(context.Background(), IngressMetadata("seldon", "example"))
+	response, err := client.Predict(ctx, NewNDArray([]float64{1, 2}))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"data":{"ndarray":[[1,2]]}}`, received)
+	assert.Equal(t, []string{"example"}, routedTo)
+	assert.Equal(t, Payload{Format: NDArray, Tensors: []TensorData{{Shape: []int{1, 2}, Values: []float64{0.1, 0.9}}}}, response)
+
+	body, err := client.PredictJSON(context.Background(), []byte(`{"data":{"tensor":{"shape":[1,1],"values":[3]}}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"data":{"tensor":{"shape":[1,1],"values":[3]}}}`, received)
+	assert.JSONEq(t, `{"meta":{"puid":"abc"},"data":{"names":["a","b"],"ndarray":[[0.1,0.9]]}}`, string(body))
+
+	_, err = client.PredictJSON(context.Background(), []byte(`{"strData":"hello"}`))
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(errors.Cause(err)))
+}
+
+func TestGRPCClient_V2(t *testing.T) {
+	var received *dynamicpb.Message
+	response := jsonMessage(t, ModelInferResponse,
+		`{"modelName":"classifier","outputs":[{"name":"predict","datatype":"FP32","shape":["1","2"],"contents":{"fp32Contents":[0.25,0.75]}}]}`)
+	conn := newGRPCServer(t, "inference.GRPCInferenceService", "ModelInfer", ModelInferRequest, func(ctx context.Context, request *dynamicpb.Message) (interface{}, error) {
+		received = request
+		return response, nil
+	})
+	client, err := NewGRPCClient(conn, V2, "classifier")
+	require.NoError(t, err)
+	assert.Equal(t, "/inference.GRPCInferenceService/ModelInfer", client.Method())
+
+	t.Run("contents", func(t *testing.T) {
+		payload, err := client.Predict(context.Background(), Payload{Format: Tensor, Tensors: []TensorData{
+			{Name: "x", Shape: []int{1, 2}, Datatype: "INT64", Values: []float64{3, 4}},
+		}})
+		require.NoError(t, err)
+		body, err := protojson.Marshal(received)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"modelName":"classifier","inputs":[{"name":"x","datatype":"INT64","shape":["1","2"],"contents":{"int64Contents":["3","4"]}}]}`, string(body))
+		assert.Equal(t, Payload{Format: Tensor, Tensors: []TensorData{
+			{Name: "predict", Datatype: "FP32", Shape: []int{1, 2}, Values: []float64{0.25, 0.75}},
+		}}, payload)
+	})
+
+	t.Run("raw contents", func(t *testing.T) {
+		raw := make([]byte, 16)
+		binary.LittleEndian.PutUint64(raw, math.Float64bits(0.5))
+		binary.LittleEndian.PutUint64(raw[8:], math.Float64bits(-1))
+		response = jsonMessage(t, ModelInferResponse, `{"outputs":[{"name":"predict","datatype":"FP64","shape":["2"]}]}`)
+		rawContents := response.Mutable(ModelInferResponse.Fields().ByName("raw_output_contents")).List()
+		rawContents.Append(protoreflect.ValueOfBytes(raw))
+
+		payload, err := client.Predict(context.Background(), NewNDArray([]float64{1}))
+		require.NoError(t, err)
+		assert.Equal(t, []float64{0.5, -1}, payload.Tensors[0].Values)
+	})
+
+	t.Run("binary", func(t *testing.T) {
+		response = jsonMessage(t, ModelInferResponse, `{"outputs":[{"name":"mask","datatype":"BYTES","shape":["1"],"contents":{"bytesContents":["bWFzaw=="]}}]}`)
+
+		payload, err := client.Predict(context.Background(), NewBinary([]byte("image")))
+		require.NoError(t, err)
+		assert.Equal(t, NewBinary([]byte("mask")), payload)
+		body, err := protojson.Marshal(received)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"modelName":"classifier","inputs":[{"name":"input-0","datatype":"BYTES","shape":["1"],"contents":{"bytesContents":["aW1hZ2U="]}}]}`, string(body))
+	})
+
+	_, err = NewGRPCClient(conn, Tensorflow, "classifier")
+	assert.EqualError(t, err, "protocol 'tensorflow' is not supported over gRPC")
+}
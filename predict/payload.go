@@ -0,0 +1,130 @@
+package predict
+
+import (
+	"fmt"
+)
+
+// Format is the way the data of a Payload is encoded by a protocol
+type Format string
+
+const (
+	NDArray Format = "ndarray" // Nested JSON arrays, e.g. Seldon's data.ndarray or TensorFlow's instances
+	Tensor  Format = "tensor"  // A shape with flat values, e.g. Seldon's data.tensor or the V2 protocol's tensors
+	Binary  Format = "binary"  // Raw bytes, e.g. an image
+)
+
+// Payload is the data of a prediction request or response, independent of the protocol it is sent with
+type Payload struct {
+	Format  Format
+	Tensors []TensorData // Inputs or outputs, unless the Format is Binary
+	Binary  []byte       // Data of a Binary payload
+}
+
+// TensorData is a named tensor with its values in row-major order
+type TensorData struct {
+	Name     string
+	Shape    []int
+	Datatype string // Datatype of the V2 protocol, e.g. FP32. DefaultDatatype if not given
+	Values   []float64
+}
+
+// NewNDArray returns a payload with a single tensor of the rows of values, which is sent as an ndarray where the
+// protocol has one
+func NewNDArray(rows ...[]float64) Payload {
+	tensor := TensorData{Shape: []int{len(rows), 0}}
+	for _, row := range rows {
+		tensor.Shape[1] = len(row)
+		tensor.Values = append(tensor.Values, row...)
+	}
+	return Payload{Format: NDArray, Tensors: []TensorData{tensor}}
+}
+
+// NewBinary returns a payload with raw bytes, e.g. an image
+func NewBinary(data []byte) Payload {
+	return Payload{Format: Binary, Binary: data}
+}
+
+// Rows returns the values of the tensor split along its first dimension
+func (t TensorData) Rows() ([][]float64, error) {
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	if len(t.Shape) == 0 || t.Shape[0] == 0 {
+		return nil, nil
+	}
+	rowLength := len(t.Values) / t.Shape[0]
+	rows := make([][]float64, 0, t.Shape[0])
+	for i := 0; i < len(t.Values); i += rowLength {
+		rows = append(rows, t.Values[i:i+rowLength])
+	}
+	return rows, nil
+}
+
+// validate checks that the dimensions of the shape are not negative, and that the number of values matches it
+func (t TensorData) validate() error {
+	size := 1
+	for _, dimension := range t.Shape {
+		if dimension < 0 {
+			return fmt.Errorf("tensor '%s' has a negative dimension in its shape %v", t.Name, t.Shape)
+		}
+		size *= dimension
+	}
+	if size != len(t.Values) {
+		return fmt.Errorf("tensor '%s' has %d values, which do not fit its shape %v", t.Name, len(t.Values), t.Shape)
+	}
+	return nil
+}
+
+// nest returns values as nested arrays of shape, as they are written in an ndarray
+func nest(values []float64, shape []int) interface{} {
+	if len(shape) == 0 {
+		return values[0]
+	}
+	if len(shape) == 1 {
+		return values
+	}
+	rows := make([]interface{}, shape[0])
+	rowLength := 0
+	if shape[0] > 0 {
+		rowLength = len(values) / shape[0]
+	}
+	for i := range rows {
+		rows[i] = nest(values[i*rowLength:(i+1)*rowLength], shape[1:])
+	}
+	return rows
+}
+
+// unnest returns the values and shape of nested arrays, as they are read from an ndarray
+func unnest(nested interface{}) ([]float64, []int, error) {
+	switch nested := nested.(type) {
+	case float64:
+		return []float64{nested}, nil, nil
+	case []interface{}:
+		var values []float64
+		var rowShape []int
+		for i, element := range nested {
+			elementValues, elementShape, err := unnest(element)
+			if err != nil {
+				return nil, nil, err
+			}
+			if i > 0 && !equalShapes(elementShape, rowShape) {
+				return nil, nil, fmt.Errorf("ndarray is not rectangular")
+			}
+			values, rowShape = append(values, elementValues...), elementShape
+		}
+		return values, append([]int{len(nested)}, rowShape...), nil
+	}
+	return nil, nil, fmt.Errorf("ndarray value %v is not numeric", nested)
+}
+
+func equalShapes(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
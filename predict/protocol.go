@@ -0,0 +1,59 @@
+/*
+Package predict builds prediction requests and parses their responses for the protocols a SeldonDeployment can serve
+its model with, which are selected by its Spec.Protocol field.
+*/
+package predict
+
+import (
+	"fmt"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+)
+
+// Protocols a SeldonDeployment can declare. The V2 inference protocol of KServe and Triton is called kfserving by
+// this version of Seldon.
+const (
+	Seldon     = machinelearningv1.ProtocolSeldon
+	Tensorflow = machinelearningv1.ProtocolTensorflow
+	V2         = machinelearningv1.ProtocolKfserving
+)
+
+// SeldonPredictionsPath is the path of the prediction endpoint of Seldon's REST API
+const SeldonPredictionsPath = "/api/v1.0/predictions"
+
+// Codec encodes prediction requests and decodes prediction responses for a protocol
+type Codec interface {
+	// Path returns the path of the prediction endpoint of model, relative to the base URL of the REST API
+	Path(model string) string
+	EncodeRequest(request Payload) ([]byte, error)
+	DecodeResponse(body []byte) (Payload, error)
+}
+
+// CodecFor returns the Codec of protocol. The Seldon protocol is used if no protocol is given.
+func CodecFor(protocol machinelearningv1.Protocol) (Codec, error) {
+	switch protocol {
+	case "", Seldon:
+		return seldonCodec{}, nil
+	case Tensorflow:
+		return tensorflowCodec{}, nil
+	case V2:
+		return v2Codec{}, nil
+	}
+	return nil, fmt.Errorf("unknown protocol '%s'", protocol)
+}
+
+// ProtocolOf returns the protocol the deployment serves its model with
+func ProtocolOf(deployment *machinelearningv1.SeldonDeployment) machinelearningv1.Protocol {
+	if deployment.Spec.Protocol == "" {
+		return Seldon
+	}
+	return deployment.Spec.Protocol
+}
+
+// ModelName returns the name of the model of the deployment in the paths of the TensorFlow and V2 protocols, which is
+// the name of the root of the graph of its first predictor
+func ModelName(deployment *machinelearningv1.SeldonDeployment) string {
+	if len(deployment.Spec.Predictors) == 0 {
+		return ""
+	}
+	return deployment.Spec.Predictors[0].Graph.Name
+}
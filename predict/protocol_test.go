@@ -0,0 +1,169 @@
+package predict
+
+import (
+	"context"
+	"encoding/json"
+	machinelearningv1 "github.com/seldonio/seldon-core/operator/apis/machinelearning.seldon.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	tensor := TensorData{Shape: []int{2, 2}, Values: []float64{1, 2, 3, 4}}
+	tests := []struct {
+		name     string
+		protocol machinelearningv1.Protocol
+		path     string
+		request  Payload
+		encoded  string
+		response string
+		decoded  Payload
+	}{
+		{
+			name:     "seldon ndarray",
+			protocol: Seldon,
+			path:     "/api/v1.0/predictions",
+			request:  NewNDArray([]float64{1, 2}, []float64{3, 4}),
+			encoded:  `{"data":{"ndarray":[[1,2],[3,4]]}}`,
+			response: `{"meta":{},"data":{"names":["a","b"],"ndarray":[[0.1,0.9],[0.8,0.2]]}}`,
+			decoded:  Payload{Format: NDArray, Tensors: []TensorData{{Shape: []int{2, 2}, Values: []float64{0.1, 0.9, 0.8, 0.2}}}},
+		},
+		{
+			name:     "seldon tensor",
+			protocol: "",
+			path:     "/api/v1.0/predictions",
+			request:  Payload{Format: Tensor, Tensors: []TensorData{tensor}},
+			encoded:  `{"data":{"tensor":{"shape":[2,2],"values":[1,2,3,4]}}}`,
+			response: `{"data":{"tensor":{"shape":[1,2],"values":[0.1,0.9]}}}`,
+			decoded:  Payload{Format: Tensor, Tensors: []TensorData{{Shape: []int{1, 2}, Values: []float64{0.1, 0.9}}}},
+		},
+		{
+			name:     "seldon binary",
+			protocol: Seldon,
+			path:     "/api/v1.0/predictions",
+			request:  NewBinary([]byte("image")),
+			encoded:  `{"binData":"aW1hZ2U="}`,
+			response: `{"binData":"bWFzaw=="}`,
+			decoded:  NewBinary([]byte("mask")),
+		},
+		{
+			name:     "tensorflow",
+			protocol: Tensorflow,
+			path:     "/v1/models/classifier:predict",
+			request:  NewNDArray([]float64{1, 2}, []float64{3, 4}),
+			encoded:  `{"instances":[[1,2],[3,4]]}`,
+			response: `{"predictions":[[0.1,0.9],[0.8,0.2]]}`,
+			decoded:  Payload{Format: NDArray, Tensors: []TensorData{{Shape: []int{2, 2}, Values: []float64{0.1, 0.9, 0.8, 0.2}}}},
+		},
+		{
+			name:     "tensorflow binary",
+			protocol: Tensorflow,
+			path:     "/v1/models/classifier:predict",
+			request:  NewBinary([]byte("image")),
+			encoded:  `{"instances":[{"b64":"aW1hZ2U="}]}`,
+			response: `{"predictions":[{"b64":"bWFzaw=="}]}`,
+			decoded:  NewBinary([]byte("mask")),
+		},
+		{
+			name:     "v2",
+			protocol: V2,
+			path:     "/v2/models/classifier/infer",
+			request:  Payload{Format: Tensor, Tensors: []TensorData{{Name: "x", Shape: []int{2, 2}, Datatype: "FP32", Values: []float64{1, 2, 3, 4}}}},
+			encoded:  `{"inputs":[{"name":"x","shape":[2,2],"datatype":"FP32","data":[1,2,3,4]}]}`,
+			response: `{"model_name":"classifier","outputs":[{"name":"predict","shape":[2],"datatype":"INT64","data":[1,0]}]}`,
+			decoded:  Payload{Format: Tensor, Tensors: []TensorData{{Name: "predict", Shape: []int{2}, Datatype: "INT64", Values: []float64{1, 0}}}},
+		},
+		{
+			name:     "v2 binary",
+			protocol: V2,
+			path:     "/v2/models/classifier/infer",
+			request:  NewBinary([]byte("image")),
+			encoded:  `{"inputs":[{"name":"input-0","shape":[1],"datatype":"BYTES","parameters":{"content_type":"base64"},"data":["aW1hZ2U="]}]}`,
+			response: `{"outputs":[{"name":"output-0","shape":[1],"datatype":"BYTES","data":["mask"]}]}`,
+			decoded:  NewBinary([]byte("mask")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := CodecFor(tt.protocol)
+			require.NoError(t, err)
+			assert.Equal(t, tt.path, codec.Path("classifier"))
+
+			encoded, err := codec.EncodeRequest(tt.request)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.encoded, string(encoded))
+
+			decoded, err := codec.DecodeResponse([]byte(tt.response))
+			require.NoError(t, err)
+			assert.Equal(t, tt.decoded, decoded)
+		})
+	}
+}
+
+func TestCodecs_Errors(t *testing.T) {
+	_, err := CodecFor("grpc")
+	assert.EqualError(t, err, "unknown protocol 'grpc'")
+
+	seldon, _ := CodecFor(Seldon)
+	_, err = seldon.EncodeRequest(Payload{Format: Tensor, Tensors: []TensorData{{Shape: []int{2}, Values: []float64{1}}}})
+	assert.Error(t, err, "values should have to fit the shape")
+	_, err = seldon.DecodeResponse([]byte(`{"data":{"ndarray":[[1,2],[3]]}}`))
+	assert.Error(t, err, "ndarray should have to be rectangular")
+	_, err = seldon.DecodeResponse([]byte(`{"strData":"hello"}`))
+	assert.Error(t, err)
+
+	v2, _ := CodecFor(V2)
+	_, err = v2.DecodeResponse([]byte(`{"outputs":[]}`))
+	assert.Error(t, err)
+}
+
+func TestTensorData_Rows(t *testing.T) {
+	rows, err := TensorData{Shape: []int{2, 2}, Values: []float64{1, 2, 3, 4}}.Rows()
+	require.NoError(t, err)
+	assert.Equal(t, [][]float64{{1, 2}, {3, 4}}, rows)
+
+	_, err = TensorData{Shape: []int{-2, -1}, Values: []float64{1, 2}}.Rows()
+	assert.Error(t, err, "negative dimensions should be rejected rather than split into rows")
+
+	seldon, _ := CodecFor(Seldon)
+	_, err = seldon.DecodeResponse([]byte(`{"data":{"tensor":{"shape":[-2,-1],"values":[1,2]}}}`))
+	assert.Error(t, err, "a response with a negative shape should be an error")
+}
+
+func TestClient_Predict(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/seldon/seldon/example/v2/models/classifier/infer" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var request map[string]interface{}
+		if err := json.Unmarshal(body, &request); err != nil || request["inputs"] == nil {
+			http.Error(w, `{"error":"no inputs"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"outputs":[{"name":"predict","shape":[1,2],"datatype":"FP64","data":[0.1,0.9]}]}`))
+	}))
+	defer server.Close()
+
+	deployment := &machinelearningv1.SeldonDeployment{Spec: machinelearningv1.SeldonDeploymentSpec{
+		Protocol:   V2,
+		Predictors: []machinelearningv1.PredictorSpec{{Name: "default", Graph: machinelearningv1.PredictiveUnit{Name: "classifier"}}},
+	}}
+	client, err := NewClient(server.Client(), server.URL+"/seldon/seldon/example/", ProtocolOf(deployment), ModelName(deployment))
+	require.NoError(t, err)
+
+	response, err := client.Predict(context.Background(), NewNDArray([]float64{1, 2}))
+	require.NoError(t, err)
+	rows, err := response.Tensors[0].Rows()
+	require.NoError(t, err)
+	assert.Equal(t, [][]float64{{0.1, 0.9}}, rows)
+
+	_, err = client.Predict(context.Background(), Payload{Format: Tensor})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not encode request")
+}
@@ -0,0 +1,68 @@
+package predict
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// seldonMessage is a request or response of Seldon's REST API
+type seldonMessage struct {
+	Data    *seldonData `json:"data,omitempty"`
+	BinData []byte      `json:"binData,omitempty"` // Written as base64
+}
+
+type seldonData struct {
+	NDArray interface{}   `json:"ndarray,omitempty"`
+	Tensor  *seldonTensor `json:"tensor,omitempty"`
+}
+
+type seldonTensor struct {
+	Shape  []int     `json:"shape"`
+	Values []float64 `json:"values"`
+}
+
+// seldonCodec speaks the Seldon protocol, e.g. {"data":{"ndarray":[[1,2]]}}
+type seldonCodec struct{}
+
+func (seldonCodec) Path(model string) string {
+	return SeldonPredictionsPath
+}
+
+func (seldonCodec) EncodeRequest(request Payload) ([]byte, error) {
+	if request.Format == Binary {
+		return json.Marshal(seldonMessage{BinData: request.Binary})
+	}
+	if len(request.Tensors) != 1 {
+		return nil, fmt.Errorf("the seldon protocol takes a single tensor, got %d", len(request.Tensors))
+	}
+	tensor := request.Tensors[0]
+	if err := tensor.validate(); err != nil {
+		return nil, err
+	}
+	if request.Format == Tensor {
+		return json.Marshal(seldonMessage{Data: &seldonData{Tensor: &seldonTensor{Shape: tensor.Shape, Values: tensor.Values}}})
+	}
+	return json.Marshal(seldonMessage{Data: &seldonData{NDArray: nest(tensor.Values, tensor.Shape)}})
+}
+
+func (seldonCodec) DecodeResponse(body []byte) (Payload, error) {
+	var response seldonMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		return Payload{}, errors.Wrap(err, "could not parse seldon response")
+	}
+	switch {
+	case response.BinData != nil:
+		return NewBinary(response.BinData), nil
+	case response.Data != nil && response.Data.Tensor != nil:
+		tensor := TensorData{Shape: response.Data.Tensor.Shape, Values: response.Data.Tensor.Values}
+		return Payload{Format: Tensor, Tensors: []TensorData{tensor}}, tensor.validate()
+	case response.Data != nil && response.Data.NDArray != nil:
+		values, shape, err := unnest(response.Data.NDArray)
+		if err != nil {
+			return Payload{}, errors.Wrap(err, "could not parse data.ndarray")
+		}
+		return Payload{Format: NDArray, Tensors: []TensorData{{Shape: shape, Values: values}}}, nil
+	}
+	return Payload{}, fmt.Errorf("seldon response has neither data.ndarray, data.tensor nor binData")
+}
@@ -0,0 +1,61 @@
+package predict
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// tensorflowBinary is how TensorFlow Serving writes binary values, as base64
+type tensorflowBinary struct {
+	B64 []byte `json:"b64"`
+}
+
+// tensorflowCodec speaks the row format of the TensorFlow Serving REST API, e.g. {"instances":[[1,2]]}
+type tensorflowCodec struct{}
+
+func (tensorflowCodec) Path(model string) string {
+	return fmt.Sprintf("/v1/models/%s:predict", model)
+}
+
+func (tensorflowCodec) EncodeRequest(request Payload) ([]byte, error) {
+	if request.Format == Binary {
+		return json.Marshal(map[string]interface{}{"instances": []tensorflowBinary{{B64: request.Binary}}})
+	}
+	if len(request.Tensors) != 1 {
+		return nil, fmt.Errorf("the tensorflow protocol takes a single tensor, got %d", len(request.Tensors))
+	}
+	tensor := request.Tensors[0]
+	if err := tensor.validate(); err != nil {
+		return nil, err
+	}
+	if len(tensor.Shape) == 0 {
+		return nil, fmt.Errorf("the tensorflow protocol takes a list of instances, got a scalar")
+	}
+	return json.Marshal(map[string]interface{}{"instances": nest(tensor.Values, tensor.Shape)})
+}
+
+func (tensorflowCodec) DecodeResponse(body []byte) (Payload, error) {
+	var response struct {
+		Predictions json.RawMessage `json:"predictions"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return Payload{}, errors.Wrap(err, "could not parse tensorflow response")
+	}
+	if response.Predictions == nil {
+		return Payload{}, fmt.Errorf("tensorflow response has no predictions")
+	}
+	var binary []tensorflowBinary
+	if err := json.Unmarshal(response.Predictions, &binary); err == nil && len(binary) == 1 && binary[0].B64 != nil {
+		return NewBinary(binary[0].B64), nil
+	}
+	var predictions interface{}
+	if err := json.Unmarshal(response.Predictions, &predictions); err != nil {
+		return Payload{}, errors.Wrap(err, "could not parse predictions")
+	}
+	values, shape, err := unnest(predictions)
+	if err != nil {
+		return Payload{}, errors.Wrap(err, "could not parse predictions")
+	}
+	return Payload{Format: NDArray, Tensors: []TensorData{{Shape: shape, Values: values}}}, nil
+}
@@ -0,0 +1,114 @@
+package predict
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// DefaultDatatype is the V2 datatype of tensors that do not declare one
+const DefaultDatatype = "FP64"
+
+// BytesDatatype is the V2 datatype of binary data
+const BytesDatatype = "BYTES"
+
+// v2Tensor is an input or output of the V2 inference protocol
+type v2Tensor struct {
+	Name       string            `json:"name"`
+	Shape      []int             `json:"shape"`
+	Datatype   string            `json:"datatype"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Data       json.RawMessage   `json:"data"`
+}
+
+// v2Codec speaks the V2 inference protocol of KServe and Triton, e.g.
+// {"inputs":[{"name":"input-0","shape":[1,2],"datatype":"FP32","data":[1,2]}]}
+type v2Codec struct{}
+
+func (v2Codec) Path(model string) string {
+	return fmt.Sprintf("/v2/models/%s/infer", model)
+}
+
+func (v2Codec) EncodeRequest(request Payload) ([]byte, error) {
+	if request.Format == Binary {
+		// Binary data is sent as a base64 string, as JSON strings cannot hold arbitrary bytes
+		data, err := json.Marshal([]string{base64.StdEncoding.EncodeToString(request.Binary)})
+		if err != nil {
+			return nil, err
+		}
+		input := v2Tensor{
+			Name:       "input-0",
+			Shape:      []int{1},
+			Datatype:   BytesDatatype,
+			Parameters: map[string]string{"content_type": "base64"},
+			Data:       data,
+		}
+		return json.Marshal(map[string]interface{}{"inputs": []v2Tensor{input}})
+	}
+	if len(request.Tensors) == 0 {
+		return nil, fmt.Errorf("the v2 protocol needs at least one input tensor")
+	}
+	inputs := make([]v2Tensor, 0, len(request.Tensors))
+	for i, tensor := range request.Tensors {
+		if err := tensor.validate(); err != nil {
+			return nil, err
+		}
+		input := v2Tensor{Name: tensor.Name, Shape: tensor.Shape, Datatype: tensor.Datatype}
+		if input.Name == "" {
+			input.Name = fmt.Sprintf("input-%d", i)
+		}
+		if input.Datatype == "" {
+			input.Datatype = DefaultDatatype
+		}
+		var err error
+		if input.Data, err = json.Marshal(tensor.Values); err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+	return json.Marshal(map[string]interface{}{"inputs": inputs})
+}
+
+func (v2Codec) DecodeResponse(body []byte) (Payload, error) {
+	var response struct {
+		Outputs []v2Tensor `json:"outputs"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return Payload{}, errors.Wrap(err, "could not parse v2 response")
+	}
+	if len(response.Outputs) == 0 {
+		return Payload{}, fmt.Errorf("v2 response has no outputs")
+	}
+	if output := response.Outputs[0]; output.Datatype == BytesDatatype {
+		return decodeV2Bytes(output)
+	}
+	payload := Payload{Format: Tensor}
+	for _, output := range response.Outputs {
+		tensor := TensorData{Name: output.Name, Shape: output.Shape, Datatype: output.Datatype}
+		if err := json.Unmarshal(output.Data, &tensor.Values); err != nil {
+			return Payload{}, errors.Wrapf(err, "could not parse data of output '%s'", output.Name)
+		}
+		if err := tensor.validate(); err != nil {
+			return Payload{}, err
+		}
+		payload.Tensors = append(payload.Tensors, tensor)
+	}
+	return payload, nil
+}
+
+// decodeV2Bytes returns the first element of a BYTES output as a binary payload
+func decodeV2Bytes(output v2Tensor) (Payload, error) {
+	var data []string
+	if err := json.Unmarshal(output.Data, &data); err != nil || len(data) == 0 {
+		return Payload{}, fmt.Errorf("could not parse data of BYTES output '%s'", output.Name)
+	}
+	if output.Parameters["content_type"] != "base64" {
+		return NewBinary([]byte(data[0])), nil
+	}
+	binary, err := base64.StdEncoding.DecodeString(data[0])
+	if err != nil {
+		return Payload{}, errors.Wrapf(err, "could not decode base64 data of output '%s'", output.Name)
+	}
+	return NewBinary(binary), nil
+}